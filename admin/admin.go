@@ -0,0 +1,231 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"embed"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sudores/firefly-iii-bank-sync/journal"
+)
+
+//go:embed ui
+var uiFiles embed.FS
+
+// BackfillFunc emits transactions of account in the time range
+type BackfillFunc func(ctx context.Context, account string, from, to time.Time) error
+
+// Admin serves token protected api for inspecting and re-driving transactions
+type Admin struct {
+	token string
+	// viewerToken allows read requests only
+	viewerToken string
+	journal     *journal.Journal
+	ctx         context.Context
+	// backfills - running backfills, see Wait
+	backfills sync.WaitGroup
+
+	mu          sync.Mutex
+	backfillers map[string]BackfillFunc
+	sources     []source
+	accounts    AccountsFunc
+}
+
+// BackfillRequest is a body of backfill request
+type BackfillRequest struct {
+	Source  string    `json:"source"`
+	Account string    `json:"account"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// New creates admin api. Empty tokens are not accepted. Retried transactions are
+// queued in journal j. Backfills run until ctx is done
+func New(ctx context.Context, token, viewerToken string, j *journal.Journal) *Admin {
+	return &Admin{
+		ctx:         ctx,
+		token:       token,
+		viewerToken: viewerToken,
+		journal:     j,
+		backfillers: map[string]BackfillFunc{},
+	}
+}
+
+// AddBackfiller adds source able to backfill transactions
+func (a *Admin) AddBackfiller(source string, fn BackfillFunc) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.backfillers[source] = fn
+}
+
+// Wait waits for running backfills. They stop once ctx passed to New is done
+func (a *Admin) Wait() {
+	a.backfills.Wait()
+}
+
+// Register sets admin api handlers and web ui on http.DefaultServeMux
+func (a *Admin) Register() {
+	ui, _ := fs.Sub(uiFiles, "ui")
+	http.Handle(uiPath, http.StripPrefix(uiPath, http.FileServer(http.FS(ui))))
+	http.HandleFunc(apiPath+"/status", a.authenticate(a.status))
+	http.HandleFunc(apiPath+"/transactions", a.authenticate(a.listTransactions))
+	http.HandleFunc(apiPath+"/transactions/", a.authenticate(a.transaction))
+	http.HandleFunc(apiPath+"/backfill", a.authenticate(a.backfill))
+}
+
+// authenticate passes requests with admin token and read requests with viewer token
+func (a *Admin) authenticate(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		admin, viewer := a.authorized(r)
+		switch {
+		case admin:
+		case viewer && r.Method == http.MethodGet:
+		case viewer:
+			writeError(w, http.StatusForbidden, ErrReadOnly)
+			return
+		default:
+			log.Warn().Msgf("Unauthorized admin api request from %s", r.RemoteAddr)
+			writeError(w, http.StatusUnauthorized, ErrUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// authorized reports whether request bears admin or viewer token
+func (a *Admin) authorized(r *http.Request) (admin, viewer bool) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		return false, false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1,
+		subtle.ConstantTimeCompare([]byte(token), []byte(a.viewerToken)) == 1
+}
+
+// listTransactions handles GET /transactions?status=&limit=
+func (a *Admin) listTransactions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+	limit := defaultListLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			writeError(w, http.StatusBadRequest, ErrBadLimit)
+			return
+		}
+	}
+	records := a.journal.List(r.URL.Query().Get("status"), limit)
+	// Payloads are shown for a single transaction only
+	for i := range records {
+		records[i].Payload = nil
+	}
+	writeJSON(w, http.StatusOK, records)
+}
+
+// transaction handles GET /transactions/{id}, POST /transactions/{id}/retry
+// and POST /transactions/{id}/skip
+func (a *Admin) transaction(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, apiPath+"/transactions/"), "/")
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		record, ok := a.journal.Get(id)
+		if !ok {
+			writeError(w, http.StatusNotFound, journal.ErrNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, record)
+	case action == "retry" && r.Method == http.MethodPost:
+		if err := a.journal.Retry(id); err != nil {
+			writeJournalError(w, err)
+			return
+		}
+		log.Info().Msgf("Retrying transaction %s", id)
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": journal.StatusPending})
+	case action == "skip" && r.Method == http.MethodPost:
+		if err := a.journal.Skip(id); err != nil {
+			writeJournalError(w, err)
+			return
+		}
+		log.Info().Msgf("Transaction %s is skipped", id)
+		writeJSON(w, http.StatusOK, map[string]string{"status": journal.StatusSkipped})
+	case action == "" || action == "retry" || action == "skip":
+		writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+	default:
+		writeError(w, http.StatusNotFound, ErrUnknownAction)
+	}
+}
+
+// backfill handles POST /backfill. Backfill runs in background as sources are rate limited
+func (a *Admin) backfill(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+	req := BackfillRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.To.IsZero() {
+		req.To = time.Now()
+	}
+	if req.Account == "" || req.From.IsZero() || !req.From.Before(req.To) {
+		writeError(w, http.StatusBadRequest, ErrBadBackfillRequest)
+		return
+	}
+	a.mu.Lock()
+	fn, ok := a.backfillers[req.Source]
+	a.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusBadRequest, ErrBackfillUnsupported)
+		return
+	}
+	a.backfills.Add(1)
+	go func() {
+		defer a.backfills.Done()
+		log.Info().Msgf("Backfill of %s account %s from %s to %s started", req.Source, req.Account, req.From, req.To)
+		if err := fn(a.ctx, req.Account, req.From, req.To); err != nil {
+			log.Warn().Err(err).Msgf("Backfill of %s account %s failed", req.Source, req.Account)
+			return
+		}
+		log.Info().Msgf("Backfill of %s account %s finished", req.Source, req.Account)
+	}()
+	writeJSON(w, http.StatusAccepted, req)
+}
+
+func writeJournalError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, journal.ErrNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, journal.ErrAlreadyCreated):
+		writeError(w, http.StatusConflict, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, errorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Warn().Err(err).Msg("Failed to write admin api response")
+	}
+}
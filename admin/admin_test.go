@@ -0,0 +1,83 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sudores/firefly-iii-bank-sync/journal"
+	"github.com/sudores/firefly-iii-bank-sync/store"
+)
+
+func TestAuthenticate(t *testing.T) {
+	st, err := store.Open(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := journal.New(st, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		token       string
+		viewerToken string
+		method      string
+		bearer      string
+		want        int
+	}{
+		{"admin reads", "admin", "viewer", http.MethodGet, "admin", http.StatusOK},
+		{"admin writes", "admin", "viewer", http.MethodPost, "admin", http.StatusOK},
+		{"viewer reads", "admin", "viewer", http.MethodGet, "viewer", http.StatusOK},
+		{"viewer writes", "admin", "viewer", http.MethodPost, "viewer", http.StatusForbidden},
+		{"wrong token", "admin", "viewer", http.MethodGet, "other", http.StatusUnauthorized},
+		{"no token", "admin", "", http.MethodGet, "", http.StatusUnauthorized},
+		{"viewer only", "", "viewer", http.MethodPost, "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		a := New(context.Background(), tt.token, tt.viewerToken, j)
+		handler := a.authenticate(func(w http.ResponseWriter, r *http.Request) {})
+		r := httptest.NewRequest(tt.method, apiPath+"/status", nil)
+		if tt.bearer != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.bearer)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
+
+func TestWaitBackfills(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	a := New(ctx, "admin", "", nil)
+	started, stopped := make(chan struct{}), make(chan struct{})
+	a.AddBackfiller("monobank", func(ctx context.Context, account string, from, to time.Time) error {
+		close(started)
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		close(stopped)
+		return ctx.Err()
+	})
+	r := httptest.NewRequest(http.MethodPost, apiPath+"/backfill",
+		strings.NewReader(`{"source": "monobank", "account": "acc", "from": "2026-10-01T00:00:00Z"}`))
+	w := httptest.NewRecorder()
+	a.backfill(w, r)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	<-started
+
+	cancel()
+	a.Wait()
+	select {
+	case <-stopped:
+	default:
+		t.Error("Wait returned before backfill stopped")
+	}
+}
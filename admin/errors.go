@@ -0,0 +1,13 @@
+package admin
+
+import "errors"
+
+var (
+	ErrUnauthorized        = errors.New("Admin token is invalid")
+	ErrReadOnly            = errors.New("Viewer token allows read requests only")
+	ErrMethodNotAllowed    = errors.New("Method is not allowed")
+	ErrUnknownAction       = errors.New("Unknown transaction action")
+	ErrBadLimit            = errors.New("Limit must be a positive number")
+	ErrBadBackfillRequest  = errors.New("Account and from before to are required")
+	ErrBackfillUnsupported = errors.New("Source does not support backfill")
+)
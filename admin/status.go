@@ -0,0 +1,109 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+	"github.com/sudores/firefly-iii-bank-sync/health"
+	"github.com/sudores/firefly-iii-bank-sync/journal"
+)
+
+// AccountsFunc returns bank accounts mapped to destination accounts
+type AccountsFunc func(ctx context.Context) ([]dto.AccountMapping, error)
+
+type source struct {
+	name        string
+	check       health.CheckFunc
+	lastWebhook func() time.Time
+}
+
+// SourceStatus is a state of transactions source
+type SourceStatus struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// LastWebhook - time of the last webhook receipt, for sources served by webhook
+	LastWebhook  *time.Time `json:"last_webhook,omitempty"`
+	LastReceived *time.Time `json:"last_received,omitempty"`
+}
+
+// Status is a response of status endpoint
+type Status struct {
+	Sources       []SourceStatus       `json:"sources"`
+	Accounts      []dto.AccountMapping `json:"accounts"`
+	AccountsError string               `json:"accounts_error,omitempty"`
+	Failed        int                  `json:"failed"`
+	// ReadOnly - request bears viewer token, transactions can't be retried
+	ReadOnly bool `json:"read_only"`
+}
+
+// AddSource adds source shown in status. lastWebhook may be nil for sources
+// not served by webhook
+func (a *Admin) AddSource(name string, check health.CheckFunc, lastWebhook func() time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sources = append(a.sources, source{name: name, check: check, lastWebhook: lastWebhook})
+}
+
+// SetAccounts sets func account mappings shown in status are got with
+func (a *Admin) SetAccounts(fn AccountsFunc) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.accounts = fn
+}
+
+// status handles GET /status
+func (a *Admin) status(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), statusTimeout)
+	defer cancel()
+	a.mu.Lock()
+	sources := append([]source{}, a.sources...)
+	accounts := a.accounts
+	a.mu.Unlock()
+
+	status := Status{
+		Sources:  []SourceStatus{},
+		Accounts: []dto.AccountMapping{},
+		Failed:   a.journal.Count(journal.StatusFailed),
+	}
+	if admin, _ := a.authorized(r); !admin {
+		status.ReadOnly = true
+	}
+	for _, s := range sources {
+		st := SourceStatus{Name: s.name, Status: health.StatusOK}
+		detail, err := s.check(ctx)
+		st.Detail = detail
+		if err != nil {
+			st.Status = health.StatusFail
+			st.Error = err.Error()
+		}
+		if s.lastWebhook != nil {
+			st.LastWebhook = timeOrNil(s.lastWebhook())
+		}
+		st.LastReceived = timeOrNil(a.journal.LastReceived(s.name))
+		status.Sources = append(status.Sources, st)
+	}
+	if accounts != nil {
+		mappings, err := accounts(ctx)
+		if err != nil {
+			status.AccountsError = err.Error()
+		} else {
+			status.Accounts = mappings
+		}
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,10 @@
+package admin
+
+import "time"
+
+const (
+	uiPath           = "/admin/"
+	apiPath          = "/admin/api"
+	defaultListLimit = 50
+	statusTimeout    = time.Second * 10
+)
@@ -3,8 +3,24 @@ package dto
 import "time"
 
 type TransactionDTO struct {
-	AccountID   string                    `json:"account_id"`
-	Transaction TransactionDTOTransaction `json:"transaction"`
+	AccountID string `json:"account_id"`
+	// TransferAccountID - own account money is moved to or from, empty if it is not a transfer
+	TransferAccountID string                    `json:"transfer_account_id,omitempty"`
+	Transaction       TransactionDTOTransaction `json:"transaction"`
+	// Category, Budget and Tags are set by rules and applied by destinations
+	Category string   `json:"category,omitempty"`
+	Budget   string   `json:"budget,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	// CounterAccount - name of expense or revenue account of counterparty, set by rules
+	CounterAccount string `json:"counter_account,omitempty"`
+	// Splits - parts of the transaction with their own categories, set by rules.
+	// Amounts are positive and sum up to the transaction amount
+	Splits []Split `json:"splits,omitempty"`
+	// Trace - trace context of the transaction pipeline (W3C trace context headers)
+	Trace map[string]string `json:"trace,omitempty"`
+	// Enqueued is called once the transaction is durably recorded by the pipeline, with
+	// error if recording failed. Sources acknowledge receipt after it. May be nil
+	Enqueued func(err error) `json:"-"`
 }
 
 type TransactionDTOTransaction struct {
@@ -17,8 +33,47 @@ type TransactionDTOTransaction struct {
 	CurrencyCode int32     `json:"currency_code"`
 	CounterIban  string    `json:"counter_iban"`
 	CounterName  string    `json:"counter_name"`
+	// CounterEdrpou - registration code of counterparty company
+	CounterEdrpou string `json:"counter_edrpou,omitempty"`
+	Balance       int64  `json:"balance"`
+	// ForeignAmount - amount in ForeignCurrencyCode when operation currency differs from account one
+	ForeignAmount       int64 `json:"foreign_amount,omitempty"`
+	ForeignCurrencyCode int32 `json:"foreign_currency_code,omitempty"`
+}
+
+// Split is a part of transaction
+type Split struct {
+	Amount      int64  `json:"amount"`
+	Description string `json:"description,omitempty"`
+	Category    string `json:"category,omitempty"`
+	Budget      string `json:"budget,omitempty"`
+}
+
+// SavingsGoal is a savings account with a target amount (e.g. monobank jar)
+type SavingsGoal struct {
+	AccountID    string `json:"account_id"`
+	Name         string `json:"name"`
+	Goal         int64  `json:"goal"`
+	Balance      int64  `json:"balance"`
+	CurrencyCode int32  `json:"currency_code"`
+}
+
+// ExchangeRate - price of one unit of From currency in To currency
+type ExchangeRate struct {
+	From int32     `json:"from"`
+	To   int32     `json:"to"`
+	Rate float64   `json:"rate"`
+	Date time.Time `json:"date"`
 }
 
 type ToTransactionDTOer interface {
 	ToTransactionDTO() TransactionDTO
 }
+
+// AccountMapping - bank account and the destination account it is synced to
+type AccountMapping struct {
+	Source          string `json:"source"`
+	AccountID       string `json:"account_id"`
+	DestinationID   string `json:"destination_id"`
+	DestinationName string `json:"destination_name"`
+}
@@ -0,0 +1,9 @@
+package mailbox
+
+import "errors"
+
+var (
+	ErrNoParser   = errors.New("No parser configured for the message sender")
+	ErrNoTextBody = errors.New("Message has no text or html body")
+	ErrNoImporter = errors.New("No importer registered for the attachment type")
+)
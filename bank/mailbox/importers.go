@@ -0,0 +1,31 @@
+package mailbox
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+	"github.com/sudores/firefly-iii-bank-sync/bank/sms"
+)
+
+// JSONImporter imports json array of transactions, the format of import command
+type JSONImporter struct{}
+
+func (JSONImporter) Import(filename string, data []byte, received time.Time) ([]*dto.TransactionDTO, error) {
+	transactions := []*dto.TransactionDTO{}
+	if err := json.Unmarshal(data, &transactions); err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+// SMSImporter imports notifications separated by empty lines, the sms format of
+// import command. Notifications without time get the time message was received
+type SMSImporter struct {
+	Templates []sms.Template
+}
+
+func (i SMSImporter) Import(filename string, data []byte, received time.Time) ([]*dto.TransactionDTO, error) {
+	return sms.ParseNotifications(i.Templates, bytes.NewReader(data), received)
+}
@@ -0,0 +1,273 @@
+package mailbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/rs/zerolog/log"
+	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+	"github.com/sudores/firefly-iii-bank-sync/bank/sms"
+)
+
+// MailboxConnection polls IMAP folder for bank notifications and statements
+type MailboxConnection struct {
+	TransactionChan chan *dto.TransactionDTO
+
+	addr          string
+	username      string
+	password      string
+	folder        string
+	useTLS        bool
+	pollInterval  time.Duration
+	processedFlag string
+
+	parsers   []SenderParser
+	importers map[string]AttachmentImporter
+
+	// skipped - uids of messages left unflagged, valid while folder uidValidity is the same
+	skipped     map[uint32]bool
+	uidValidity uint32
+}
+
+// NewMailboxConnection builds connection with parsers from parsersFile
+func NewMailboxConnection(addr, username, password, folder, parsersFile, processedFlag string,
+	useTLS bool, pollInterval time.Duration) (*MailboxConnection, error) {
+	parsers, err := LoadParsers(parsersFile)
+	if err != nil {
+		return nil, err
+	}
+	for i := range parsers {
+		if parsers[i].Templates, err = sms.CompileTemplates(parsers[i].Templates); err != nil {
+			return nil, err
+		}
+	}
+	return &MailboxConnection{
+		TransactionChan: make(chan *dto.TransactionDTO, 2),
+		addr:            addr,
+		username:        username,
+		password:        password,
+		folder:          folder,
+		useTLS:          useTLS,
+		pollInterval:    pollInterval,
+		processedFlag:   processedFlag,
+		parsers:         parsers,
+		importers:       map[string]AttachmentImporter{},
+		skipped:         map[uint32]bool{},
+	}, nil
+}
+
+// RegisterImporter makes attachments with extension ext (e.g. ".csv") to be imported by imp
+func (m *MailboxConnection) RegisterImporter(ext string, imp AttachmentImporter) {
+	m.importers[ext] = imp
+}
+
+// Serve polls the mailbox until ctx is done
+func (m *MailboxConnection) Serve(ctx context.Context) {
+	ticker := time.NewTicker(m.pollInterval)
+	defer ticker.Stop()
+	for {
+		if err := m.poll(); err != nil {
+			log.Warn().Err(err).Msg("Failed to poll mailbox")
+		}
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Shutting down mailbox connection. Bye!!!")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *MailboxConnection) dial() (*client.Client, error) {
+	if m.useTLS {
+		return client.DialTLS(m.addr, &tls.Config{})
+	}
+	return client.Dial(m.addr)
+}
+
+// poll fetches messages not marked with processed flag and emits their transactions.
+// Senders are fetched first, so only bodies of messages of senders with parser are
+// downloaded. Messages not flagged as processed are remembered and not fetched again
+// by this connection
+func (m *MailboxConnection) poll() error {
+	c, err := m.dial()
+	if err != nil {
+		return err
+	}
+	defer c.Logout()
+
+	if err := c.Login(m.username, m.password); err != nil {
+		return err
+	}
+	status, err := c.Select(m.folder, false)
+	if err != nil {
+		return err
+	}
+	if status.UidValidity != m.uidValidity {
+		// Uids of the previous folder state refer to other messages
+		m.uidValidity, m.skipped = status.UidValidity, map[uint32]bool{}
+	}
+
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{m.processedFlag}
+	found, err := c.UidSearch(criteria)
+	if err != nil {
+		return err
+	}
+	uids := []uint32{}
+	for _, uid := range found {
+		if !m.skipped[uid] {
+			uids = append(uids, uid)
+		}
+	}
+	if len(uids) == 0 {
+		return nil
+	}
+	log.Debug().Msgf("%d new messages in mailbox", len(uids))
+
+	if uids, err = m.fromKnownSenders(c, uids); err != nil {
+		return err
+	}
+	if len(uids) == 0 {
+		return nil
+	}
+
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(uids...)
+	section := &imap.BodySectionName{Peek: true}
+	messages := make(chan *imap.Message, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.UidFetch(seqSet, []imap.FetchItem{imap.FetchUid, section.FetchItem()}, messages)
+	}()
+
+	processed := new(imap.SeqSet)
+	for msg := range messages {
+		body := msg.GetBody(section)
+		if body == nil {
+			continue
+		}
+		raw, err := io.ReadAll(body)
+		if err != nil {
+			log.Warn().Err(err).Msgf("Failed to read message %d", msg.Uid)
+			continue
+		}
+		ok, err := m.processMessage(raw)
+		if err != nil {
+			log.Warn().Err(err).Msgf("Failed to process message %d", msg.Uid)
+		}
+		if ok {
+			processed.AddNum(msg.Uid)
+		} else {
+			m.skipped[msg.Uid] = true
+		}
+	}
+	if err := <-done; err != nil {
+		return err
+	}
+	if processed.Empty() {
+		return nil
+	}
+	flags := []interface{}{m.processedFlag, imap.SeenFlag}
+	return c.UidStore(processed, imap.FormatFlagsOp(imap.AddFlags, true), flags, nil)
+}
+
+// fromKnownSenders fetches envelopes of messages and returns uids of ones sent by
+// senders with parser. The others are skipped
+func (m *MailboxConnection) fromKnownSenders(c *client.Client, uids []uint32) ([]uint32, error) {
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(uids...)
+	messages := make(chan *imap.Message, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.UidFetch(seqSet, []imap.FetchItem{imap.FetchUid, imap.FetchEnvelope}, messages)
+	}()
+
+	known := []uint32{}
+	for msg := range messages {
+		from := ""
+		if msg.Envelope != nil && len(msg.Envelope.From) != 0 {
+			from = msg.Envelope.From[0].Address()
+		}
+		if m.parser(from) == nil {
+			log.Debug().Err(ErrNoParser).Msgf("Skipping message from %s", from)
+			m.skipped[msg.Uid] = true
+			continue
+		}
+		known = append(known, msg.Uid)
+	}
+	return known, <-done
+}
+
+// processMessage emits transactions from raw message. Returns true when the message
+// produced transactions and has no attachments left without importer, only such
+// messages are marked processed. Others are left to the user or to importers
+// registered later
+func (m *MailboxConnection) processMessage(raw []byte) (bool, error) {
+	msg, err := parseMessage(bytes.NewReader(raw))
+	if err != nil {
+		return false, err
+	}
+	parser := m.parser(msg.From)
+	if parser == nil {
+		log.Debug().Err(ErrNoParser).Msgf("Skipping message from %s", msg.From)
+		return false, nil
+	}
+
+	var transactions []*dto.TransactionDTO
+	if msg.Text != "" {
+		match, err := sms.MatchTemplates(parser.Templates, msg.Text)
+		if err == nil {
+			trans, err := match.ToTransactionDTO(msg.Text, msg.Date)
+			if err != nil {
+				return false, err
+			}
+			transactions = append(transactions, trans)
+		} else if !parser.Attachments {
+			return false, fmt.Errorf("%w: %s", err, msg.Subject)
+		}
+	} else if !parser.Attachments {
+		return false, ErrNoTextBody
+	}
+
+	unsupported := false
+	if parser.Attachments {
+		for _, a := range msg.Attachments {
+			imp, ok := m.importers[a.ext()]
+			if !ok {
+				log.Debug().Err(ErrNoImporter).Msgf("Skipping attachment %s", a.Filename)
+				unsupported = true
+				continue
+			}
+			trans, err := imp.Import(a.Filename, a.Data, msg.Date)
+			if err != nil {
+				return false, err
+			}
+			transactions = append(transactions, trans...)
+		}
+	}
+
+	for _, trans := range transactions {
+		if parser.AccountID != "" {
+			trans.AccountID = parser.AccountID
+		}
+		m.TransactionChan <- trans
+	}
+	return len(transactions) != 0 && !unsupported, nil
+}
+
+// parser returns parser of sender address, nil if there is none
+func (m *MailboxConnection) parser(from string) *SenderParser {
+	for i := range m.parsers {
+		if m.parsers[i].matches(from) {
+			return &m.parsers[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package mailbox
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/server"
+	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+	"github.com/sudores/firefly-iii-bank-sync/bank/sms"
+)
+
+const processedFlag = "$FBSProcessed"
+
+type csvImporter struct{}
+
+func (csvImporter) Import(filename string, data []byte, received time.Time) ([]*dto.TransactionDTO, error) {
+	return []*dto.TransactionDTO{{Transaction: dto.TransactionDTOTransaction{ID: filename}}}, nil
+}
+
+func textMessage(from, text string) string {
+	return "From: " + from + "\r\n" +
+		"Subject: Notification\r\n" +
+		"Date: Mon, 12 Oct 2026 10:00:00 +0300\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" + text
+}
+
+func attachmentMessage(from, text, filename string, data ...string) string {
+	content := "data"
+	if len(data) != 0 {
+		content = data[0]
+	}
+	return "From: " + from + "\r\n" +
+		"Subject: Statement\r\n" +
+		"Date: Mon, 12 Oct 2026 10:00:00 +0300\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n" +
+		"\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\n" + text + "\r\n" +
+		"--b\r\nContent-Type: application/octet-stream\r\n" +
+		"Content-Disposition: attachment; filename=" + filename + "\r\n\r\n" + content + "\r\n" +
+		"--b--\r\n"
+}
+
+// TestPollFlagsMessagesWithTransactions polls IMAP server stand-in and checks
+// only messages turned to transactions completely are flagged as processed
+func TestPollFlagsMessagesWithTransactions(t *testing.T) {
+	be := memory.New()
+	user, err := be.Login(nil, "username", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mbox, err := user.GetMailbox("INBOX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	purchase := "Card *1234 purchase of 12.50 USD at Coffee. Balance 100.00"
+	bodies := map[string]string{
+		"notification":   textMessage("alerts@bank.test", purchase),
+		"unknown":        textMessage("friend@example.org", purchase),
+		"unsupported":    attachmentMessage("alerts@bank.test", "Your statement", "statement.pdf"),
+		"imported":       attachmentMessage("alerts@bank.test", purchase, "statement.csv"),
+		"no transaction": textMessage("alerts@bank.test", "Your card is blocked"),
+	}
+	uids := map[string]uint32{}
+	for name, body := range bodies {
+		if err := mbox.CreateMessage(nil, time.Now(), bytes.NewBufferString(body)); err != nil {
+			t.Fatal(err)
+		}
+		msgs := mbox.(*memory.Mailbox).Messages
+		uids[name] = msgs[len(msgs)-1].Uid
+	}
+
+	srv := server.New(be)
+	srv.AllowInsecureAuth = true
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	parsersFile := filepath.Join(t.TempDir(), "parsers.json")
+	parsers := `[{"sender": "alerts@bank.test", "account_id": "acc", "attachments": true}]`
+	if err := os.WriteFile(parsersFile, []byte(parsers), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewMailboxConnection(l.Addr().String(), "username", "password", "INBOX", parsersFile,
+		processedFlag, false, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.RegisterImporter(".csv", csvImporter{})
+
+	poll := func() int {
+		m.TransactionChan = make(chan *dto.TransactionDTO, 10)
+		if err := m.poll(); err != nil {
+			t.Fatal(err)
+		}
+		close(m.TransactionChan)
+		got := 0
+		for trans := range m.TransactionChan {
+			if trans.AccountID != "acc" {
+				t.Errorf("transaction %s account = %q, want acc", trans.Transaction.ID, trans.AccountID)
+			}
+			got++
+		}
+		return got
+	}
+	// Unsupported attachment message is skipped, its text matches no template
+	if got := poll(); got != 3 {
+		t.Errorf("got %d transactions, want 3", got)
+	}
+	// Processed messages are not fetched again
+	if got := poll(); got != 0 {
+		t.Errorf("got %d transactions on the second poll, want 0", got)
+	}
+
+	// Messages left unflagged are not fetched by this connection again
+	for _, name := range []string{"unknown", "unsupported", "no transaction"} {
+		if !m.skipped[uids[name]] {
+			t.Errorf("message %q is not skipped", name)
+		}
+	}
+
+	want := map[string]bool{
+		"notification":   true,
+		"unknown":        false,
+		"unsupported":    false,
+		"imported":       true,
+		"no transaction": false,
+	}
+	for name, uid := range uids {
+		flagged := false
+		for _, msg := range mbox.(*memory.Mailbox).Messages {
+			if msg.Uid != uid {
+				continue
+			}
+			for _, f := range msg.Flags {
+				// Keywords are case insensitive, the server stores them lowercased
+				if strings.EqualFold(f, processedFlag) {
+					flagged = true
+				}
+			}
+		}
+		if flagged != want[name] {
+			t.Errorf("message %q flagged = %v, want %v", name, flagged, want[name])
+		}
+	}
+}
+
+func TestImporters(t *testing.T) {
+	templates, err := sms.NewTemplates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &MailboxConnection{
+		TransactionChan: make(chan *dto.TransactionDTO, 10),
+		parsers:         []SenderParser{{Sender: "bank.test", AccountID: "acc", Attachments: true}},
+		importers:       map[string]AttachmentImporter{".json": JSONImporter{}, ".txt": SMSImporter{Templates: templates}},
+	}
+	received := time.Date(2026, 10, 12, 10, 0, 0, 0, time.FixedZone("", 3*3600))
+	purchase := "Card *1234 purchase of 12.50 USD at Coffee. Balance 100.00"
+	messages := []string{
+		attachmentMessage("alerts@bank.test", "Statement", "statement.json",
+			`[{"transaction": {"id": "j1", "amount": -100}}, {"transaction": {"id": "j2", "amount": 200}}]`),
+		attachmentMessage("alerts@bank.test", "Notifications", "notifications.txt",
+			"2026-10-11 09:30\r\n"+purchase+"\r\n\r\n"+purchase+"\r\n\r\nYour card is blocked"),
+	}
+	for _, raw := range messages {
+		ok, err := m.processMessage([]byte(raw))
+		if err != nil || !ok {
+			t.Fatalf("processMessage = %v, %v", ok, err)
+		}
+	}
+	close(m.TransactionChan)
+	got := []*dto.TransactionDTO{}
+	for trans := range m.TransactionChan {
+		if trans.AccountID != "acc" {
+			t.Errorf("transaction %s account = %q, want acc", trans.Transaction.ID, trans.AccountID)
+		}
+		got = append(got, trans)
+	}
+	if len(got) != 4 {
+		t.Fatalf("got %d transactions, want 4", len(got))
+	}
+	if got[0].Transaction.ID != "j1" || got[1].Transaction.Amount != 200 {
+		t.Errorf("json transactions = %+v, %+v", got[0].Transaction, got[1].Transaction)
+	}
+	timed := time.Date(2026, 10, 11, 9, 30, 0, 0, time.Local)
+	if !got[2].Transaction.Time.Equal(timed) || !got[3].Transaction.Time.Equal(received) {
+		t.Errorf("notification times = %s, %s, want %s, %s", got[2].Transaction.Time, got[3].Transaction.Time, timed, received)
+	}
+	if got[2].Transaction.Amount != -1250 || got[2].Transaction.ID == got[3].Transaction.ID {
+		t.Errorf("notifications = %+v, %+v", got[2].Transaction, got[3].Transaction)
+	}
+}
@@ -0,0 +1,96 @@
+package mailbox
+
+import (
+	"errors"
+	"html"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	_ "github.com/emersion/go-message/charset"
+	"github.com/emersion/go-message/mail"
+)
+
+var (
+	htmlBreakRe = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>|</tr>|</td>`)
+	htmlTagRe   = regexp.MustCompile(`(?s)<style.*?</style>|<script.*?</script>|<[^>]*>`)
+	spacesRe    = regexp.MustCompile(`\s+`)
+)
+
+// message is a decoded mail message
+type message struct {
+	From        string
+	Subject     string
+	Date        time.Time
+	Text        string
+	Attachments []attachment
+}
+
+type attachment struct {
+	Filename string
+	Data     []byte
+}
+
+func (a attachment) ext() string {
+	return strings.ToLower(filepath.Ext(a.Filename))
+}
+
+// parseMessage decodes message. Text holds plain text body or html body
+// converted to text when there is no plain one
+func parseMessage(r io.Reader) (*message, error) {
+	mr, err := mail.CreateReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer mr.Close()
+
+	msg := &message{}
+	if from, err := mr.Header.AddressList("From"); err == nil && len(from) != 0 {
+		msg.From = from[0].Address
+	}
+	msg.Subject, _ = mr.Header.Subject()
+	if msg.Date, err = mr.Header.Date(); err != nil {
+		msg.Date = time.Now()
+	}
+
+	var htmlBody string
+	for {
+		p, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(p.Body)
+		if err != nil {
+			return nil, err
+		}
+		switch h := p.Header.(type) {
+		case *mail.InlineHeader:
+			contentType, _, _ := h.ContentType()
+			switch contentType {
+			case "text/plain":
+				msg.Text += string(data)
+			case "text/html":
+				htmlBody += string(data)
+			}
+		case *mail.AttachmentHeader:
+			filename, _ := h.Filename()
+			msg.Attachments = append(msg.Attachments, attachment{Filename: filename, Data: data})
+		}
+	}
+	if strings.TrimSpace(msg.Text) == "" {
+		msg.Text = htmlToText(htmlBody)
+	}
+	msg.Text = strings.TrimSpace(spacesRe.ReplaceAllString(msg.Text, " "))
+	return msg, nil
+}
+
+func htmlToText(s string) string {
+	s = htmlBreakRe.ReplaceAllString(s, " ")
+	s = htmlTagRe.ReplaceAllString(s, "")
+	return html.UnescapeString(s)
+}
@@ -0,0 +1,46 @@
+package mailbox
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+	"github.com/sudores/firefly-iii-bank-sync/bank/sms"
+)
+
+// SenderParser describes how messages of a single sender are turned to transactions
+type SenderParser struct {
+	// Sender - address (or its part, e.g. domain) in From header
+	Sender string `json:"sender"`
+	// AccountID - used instead of card suffix extracted by templates when set
+	AccountID string `json:"account_id"`
+	// Templates - applied to the text body (html is stripped to text)
+	Templates []sms.Template `json:"templates"`
+	// Attachments - whether attachments are handed to the registered importers
+	Attachments bool `json:"attachments"`
+}
+
+func (p *SenderParser) matches(from string) bool {
+	return strings.Contains(strings.ToLower(from), strings.ToLower(p.Sender))
+}
+
+// AttachmentImporter parses attachment file content of message received at the
+// given time to transactions
+type AttachmentImporter interface {
+	Import(filename string, data []byte, received time.Time) ([]*dto.TransactionDTO, error)
+}
+
+// LoadParsers reads sender parsers from json file with an array of SenderParser objects
+func LoadParsers(path string) ([]SenderParser, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	parsers := []SenderParser{}
+	if err := json.Unmarshal(data, &parsers); err != nil {
+		return nil, err
+	}
+	return parsers, nil
+}
@@ -0,0 +1,141 @@
+package mono
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// WebhookAuth holds optional verification layers of webhook requests.
+// Zero value disables all of them
+type WebhookAuth struct {
+	// AllowedNets - source networks webhook requests are accepted from
+	AllowedNets []*net.IPNet
+	// RealIPHeader - header with client address set by reverse proxy (e.g. X-Real-IP)
+	RealIPHeader string
+	// Secret - required as the last path segment of webhook url or in X-FBS-Secret header
+	Secret string
+	// VerifyStatement - accept only items found in the statement API
+	VerifyStatement bool
+}
+
+// ParseNets parses CIDR list. Plain addresses are treated as single host networks
+func ParseNets(cidrs []string) ([]*net.IPNet, error) {
+	nets := []*net.IPNet{}
+	for _, v := range cidrs {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			if ip := net.ParseIP(v); ip != nil && ip.To4() == nil {
+				v += "/128"
+			} else {
+				v += "/32"
+			}
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// authenticate wraps handler with source address and secret checks.
+// Empty GET requests carry no data and are used for readiness checks, so
+// they are not limited by source address
+func (m *MonoConnection) authenticate(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		readinessCheck := r.Method == http.MethodGet && r.ContentLength == 0
+		if !readinessCheck && !m.allowedSource(r) {
+			log.Warn().Msgf("Webhook request from not allowed address %s", r.RemoteAddr)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if !m.validSecret(r) {
+			log.Warn().Msgf("Webhook request with invalid secret from %s", r.RemoteAddr)
+			http.NotFound(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (m *MonoConnection) allowedSource(r *http.Request) bool {
+	if len(m.auth.AllowedNets) == 0 {
+		return true
+	}
+	addr := r.RemoteAddr
+	if m.auth.RealIPHeader != "" && r.Header.Get(m.auth.RealIPHeader) != "" {
+		// Proxy appends the address it is connected from, the left ones are set by client
+		forwarded := strings.Split(r.Header.Get(m.auth.RealIPHeader), ",")
+		addr = strings.TrimSpace(forwarded[len(forwarded)-1])
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range m.auth.AllowedNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MonoConnection) validSecret(r *http.Request) bool {
+	if m.auth.Secret == "" {
+		return true
+	}
+	secret := r.Header.Get("X-FBS-Secret")
+	if secret == "" {
+		secret = strings.TrimPrefix(r.URL.Path, m.fBSURLPath+"/")
+	}
+	return subtle.ConstantTimeCompare([]byte(secret), []byte(m.auth.Secret)) == 1
+}
+
+// WebhookURL returns url registered in monobank
+func (m *MonoConnection) WebhookURL() string {
+	if m.auth.Secret != "" {
+		return m.fBSHost + m.fBSURLPath + "/" + m.auth.Secret
+	}
+	return m.fBSHost + m.fBSURLPath
+}
+
+// verifyStatementItem checks item is present in account statement with the same amount.
+// Item may appear in statement with delay, so statement is requested several times
+// with respect to the api rate limit
+func (m *MonoConnection) verifyStatementItem(ctx context.Context, account string, item StatementItem) error {
+	var err error
+	// Client waits for the rate limit between attempts
+	for attempt := 0; attempt < statementVerifyAttempts; attempt++ {
+		var items []StatementItem
+		from := time.Unix(item.Time, 0).Add(-time.Hour)
+		items, err = m.client.Statement(ctx, account, from, time.Now())
+		if err != nil {
+			log.Debug().Err(err).Msg("Failed to get statement for verification")
+			continue
+		}
+		for _, v := range items {
+			if v.ID == item.ID {
+				if v.Amount != item.Amount {
+					return fmt.Errorf("%w: amount %d differs from statement %d", ErrStatementMismatch, item.Amount, v.Amount)
+				}
+				return nil
+			}
+		}
+		err = ErrStatementNotFound
+	}
+	return err
+}
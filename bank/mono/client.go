@@ -0,0 +1,190 @@
+package mono
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sudores/firefly-iii-bank-sync/metrics"
+	"github.com/sudores/firefly-iii-bank-sync/tracing"
+)
+
+// Client of monobank api. Every endpoint is limited with its own token bucket
+// shared by all callers of the client, so a single client should be used per token
+type Client struct {
+	cl       *http.Client
+	apiURL   string
+	apiToken string
+
+	mu       sync.Mutex
+	limiters map[string]*tokenBucket
+}
+
+// NewClient returns client of api at apiURL (https://api.monobank.ua or a fake server)
+func NewClient(apiURL, apiToken string) *Client {
+	return &Client{
+		cl:       tracing.InstrumentClient(sourceName, metrics.InstrumentClient(sourceName, &http.Client{Timeout: time.Second * 30})),
+		apiURL:   apiURL,
+		apiToken: apiToken,
+		limiters: map[string]*tokenBucket{},
+	}
+}
+
+// ClientInfo returns client, accounts, jars and registered webhook url
+func (c *Client) ClientInfo(ctx context.Context) (*ClientInfo, error) {
+	info := ClientInfo{}
+	if err := c.do(ctx, http.MethodGet, monoClientInfoAPIPath, monoClientInfoAPIPath, nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Statement returns account statement items in the time range (up to 31 days).
+// Monobank returns up to statementPageSize newest items per request, the older
+// ones are requested until the time of the oldest item got
+func (c *Client) Statement(ctx context.Context, account string, from, to time.Time) ([]StatementItem, error) {
+	items := []StatementItem{}
+	seen := map[string]bool{}
+	end := to.Unix()
+	for {
+		path := fmt.Sprintf("%s/%s/%d/%d", monoStatementAPIPath, account, from.Unix(), end)
+		page := []StatementItem{}
+		if err := c.do(ctx, http.MethodGet, monoStatementAPIPath, path, nil, &page); err != nil {
+			return nil, err
+		}
+		oldest := end
+		for _, v := range page {
+			// Items of the second the page ends at are got again with the next page
+			if !seen[v.ID] {
+				seen[v.ID] = true
+				items = append(items, v)
+			}
+			if v.Time < oldest {
+				oldest = v.Time
+			}
+		}
+		if len(page) < statementPageSize {
+			return items, nil
+		}
+		if oldest == end {
+			// Whole page is a single second, the next one would be the same
+			log.Warn().Msgf("Statement of account %s has more than %d items at %d, the rest is skipped",
+				account, statementPageSize, end)
+			return items, nil
+		}
+		end = oldest
+	}
+}
+
+// SetWebhook registers url to push statement items to. Empty url unregisters webhook
+func (c *Client) SetWebhook(ctx context.Context, url string) error {
+	webhook, err := json.Marshal(struct {
+		WebHookUrl string `json:"webHookUrl"`
+	}{WebHookUrl: url})
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPost, monoWebhookAPIPath, monoWebhookAPIPath, webhook, nil)
+}
+
+// Currency returns exchange rates of the bank
+func (c *Client) Currency(ctx context.Context) ([]CurrencyInfo, error) {
+	rates := []CurrencyInfo{}
+	if err := c.do(ctx, http.MethodGet, monoCurrencyAPIPath, monoCurrencyAPIPath, nil, &rates); err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
+// do waits for endpoint limiter, sends request and unmarshals response to out if not nil.
+// Error responses are returned as *APIError
+func (c *Client) do(ctx context.Context, method, endpoint, path string, body []byte, out interface{}) error {
+	if err := c.limiter(endpoint).wait(ctx); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.apiURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("X-Token", c.apiToken)
+	if body != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+	log.Trace().Msgf("Monobank request %s %s", method, endpoint)
+	resp, err := c.cl.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &APIError{Endpoint: endpoint, StatusCode: resp.StatusCode}
+		if json.Unmarshal(data, apiErr) != nil || apiErr.Description == "" {
+			apiErr.Description = string(data)
+		}
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+func (c *Client) limiter(endpoint string) *tokenBucket {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	l, ok := c.limiters[endpoint]
+	if !ok {
+		l = newTokenBucket(1, apiRateLimit)
+		c.limiters[endpoint] = l
+	}
+	return l
+}
+
+// tokenBucket allows burst requests and refills one token per interval
+type tokenBucket struct {
+	mu       sync.Mutex
+	tokens   float64
+	burst    float64
+	interval time.Duration
+	last     time.Time
+}
+
+func newTokenBucket(burst int, interval time.Duration) *tokenBucket {
+	return &tokenBucket{tokens: float64(burst), burst: float64(burst), interval: interval, last: time.Now()}
+}
+
+// wait blocks until token is available or ctx is done
+func (b *tokenBucket) wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens += float64(now.Sub(b.last)) / float64(b.interval)
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - b.tokens) * float64(b.interval))
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package mono
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestClient returns client of fake api with endpoint limiters refilled every millisecond
+func newTestClient(url string, endpoints ...string) *Client {
+	c := NewClient(url, "token")
+	for _, v := range endpoints {
+		c.limiters[v] = newTokenBucket(1, time.Millisecond)
+	}
+	return c
+}
+
+func TestStatementPages(t *testing.T) {
+	// 1200 items, one per minute, the newest first as monobank returns them
+	start := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	all := []StatementItem{}
+	for i := 1199; i >= 0; i-- {
+		all = append(all, StatementItem{ID: fmt.Sprint(i), Time: start.Add(time.Duration(i) * time.Minute).Unix()})
+	}
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		var from, to int64
+		if _, err := fmt.Sscanf(strings.TrimPrefix(r.URL.Path, monoStatementAPIPath+"/acc/"), "%d/%d", &from, &to); err != nil {
+			t.Errorf("path %s: %s", r.URL.Path, err)
+		}
+		page := []StatementItem{}
+		for _, v := range all {
+			if v.Time >= from && v.Time <= to && len(page) < statementPageSize {
+				page = append(page, v)
+			}
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	defer srv.Close()
+
+	c := newTestClient(srv.URL, monoStatementAPIPath)
+	items, err := c.Statement(context.Background(), "acc", start, start.Add(time.Hour*24))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != len(all) {
+		t.Errorf("got %d items, want %d", len(items), len(all))
+	}
+	ids := map[string]bool{}
+	for _, v := range items {
+		if ids[v.ID] {
+			t.Errorf("item %s is returned twice", v.ID)
+		}
+		ids[v.ID] = true
+	}
+	if requests != 3 {
+		t.Errorf("got %d requests, want 3", requests)
+	}
+}
+
+func TestClientRequests(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"errorDescription": "Unknown 'X-Token'"}`)
+			return
+		}
+		switch r.URL.Path {
+		case monoClientInfoAPIPath:
+			fmt.Fprint(w, `{"clientId": "c", "webHookUrl": "https://fbs.test/hook",
+				"accounts": [{"id": "acc", "currencyCode": 980}], "jars": [{"id": "jar", "title": "Trip"}]}`)
+		case monoWebhookAPIPath:
+			body, _ := io.ReadAll(r.Body)
+			if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" ||
+				string(body) != `{"webHookUrl":"https://fbs.test/hook"}` {
+				t.Errorf("webhook request %s %s %s", r.Method, r.Header.Get("Content-Type"), body)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c := newTestClient(srv.URL, monoClientInfoAPIPath, monoWebhookAPIPath)
+	info, err := c.ClientInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.WebHookURL != "https://fbs.test/hook" || len(info.Accounts) != 1 || info.Accounts[0].CurrencyCode != 980 ||
+		len(info.Jars) != 1 || info.Jars[0].Title != "Trip" {
+		t.Errorf("client info = %+v", info)
+	}
+	if err := c.SetWebhook(context.Background(), "https://fbs.test/hook"); err != nil {
+		t.Error(err)
+	}
+
+	c = newTestClient(srv.URL, monoClientInfoAPIPath)
+	c.apiToken = "wrong"
+	_, err = c.ClientInfo(context.Background())
+	apiErr := &APIError{}
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden || apiErr.Description != "Unknown 'X-Token'" {
+		t.Errorf("error = %v", err)
+	}
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("error %v is not %v", err, ErrUnauthorized)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	tests := []struct {
+		code int
+		body string
+		want error
+		desc string
+	}{
+		{http.StatusTooManyRequests, `{"errorDescription": "Too many requests"}`, ErrRateLimited, "Too many requests"},
+		{http.StatusUnauthorized, `{"errorDescription": "Unknown token"}`, ErrUnauthorized, "Unknown token"},
+		{http.StatusBadGateway, `<html>Bad gateway</html>`, ErrUnavailable, "<html>Bad gateway</html>"},
+		{http.StatusBadRequest, `{"errorDescription": "Period must be no more than 31 days"}`, ErrBadRequest,
+			"Period must be no more than 31 days"},
+	}
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.code)
+			fmt.Fprint(w, tt.body)
+		}))
+		c := newTestClient(srv.URL, monoCurrencyAPIPath)
+		_, err := c.Currency(context.Background())
+		srv.Close()
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%d: error %v is not %v", tt.code, err, tt.want)
+		}
+		apiErr := &APIError{}
+		if !errors.As(err, &apiErr) || apiErr.Description != tt.desc || apiErr.Endpoint != monoCurrencyAPIPath {
+			t.Errorf("%d: error = %#v", tt.code, err)
+		}
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	interval := 50 * time.Millisecond
+	b := newTokenBucket(2, interval)
+	ctx := context.Background()
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := b.wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Burst is taken at once, the third token is waited for
+	if elapsed := time.Since(start); elapsed < interval*8/10 || elapsed > interval*4 {
+		t.Errorf("3 tokens of burst 2 are taken in %s, want about %s", elapsed, interval)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, interval/5)
+	defer cancel()
+	if err := b.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wait of empty bucket = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestClientLimitsEndpointsSeparately(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	}))
+	defer srv.Close()
+	c := NewClient(srv.URL, "token")
+	ctx := context.Background()
+	if _, err := c.Currency(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// The other endpoint has its own token
+	if _, err := c.Statement(ctx, "acc", time.Now().Add(-time.Hour), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	// The same endpoint is limited to one request per apiRateLimit
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if _, err := c.Currency(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("second request = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,95 @@
+package mono
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+)
+
+// RefreshAccounts fetches accounts and jars used for transfer recognition and
+// account currencies. It is needed before Backfill when connection is not served
+func (m *MonoConnection) RefreshAccounts(ctx context.Context) error {
+	info, err := m.client.ClientInfo(ctx)
+	if err != nil {
+		return err
+	}
+	m.refreshAccounts(info)
+	return nil
+}
+
+// refreshAccounts updates jars used for transfer recognition and account currencies
+func (m *MonoConnection) refreshAccounts(info *ClientInfo) {
+	m.jars.setJars(info.Jars)
+	m.currenciesMu.Lock()
+	defer m.currenciesMu.Unlock()
+	for _, v := range info.Accounts {
+		m.currencies[v.ID] = v.CurrencyCode
+	}
+	for _, v := range info.Jars {
+		m.currencies[v.ID] = v.CurrencyCode
+	}
+}
+
+// setAccountCurrency sets transaction currency to the account one keeping operation
+// currency as foreign. Foreign amount is dropped when currencies match. Accounts are
+// fetched when account currency is unknown yet, if it fails the currency is left
+// unset, so firefly-iii uses the account currency
+func (m *MonoConnection) setAccountCurrency(ctx context.Context, trans *dto.TransactionDTO) {
+	currency, ok := m.accountCurrency(trans.AccountID)
+	if !ok {
+		fetchCtx, cancel := context.WithTimeout(ctx, accountsFetchTimeout)
+		info, err := m.client.ClientInfo(fetchCtx)
+		cancel()
+		if err != nil {
+			log.Warn().Err(err).Msgf("Failed to get currency of account %s", trans.AccountID)
+		} else {
+			m.refreshAccounts(info)
+			currency, ok = m.accountCurrency(trans.AccountID)
+		}
+	}
+	if !ok {
+		trans.Transaction.CurrencyCode = 0
+		return
+	}
+	if currency == trans.Transaction.ForeignCurrencyCode {
+		trans.Transaction.ForeignAmount = 0
+		trans.Transaction.ForeignCurrencyCode = 0
+		return
+	}
+	trans.Transaction.CurrencyCode = currency
+}
+
+func (m *MonoConnection) accountCurrency(account string) (int32, bool) {
+	m.currenciesMu.Lock()
+	defer m.currenciesMu.Unlock()
+	currency, ok := m.currencies[account]
+	return currency, ok
+}
+
+// ExchangeRates returns bank exchange rates. Rate of selling currency A is used as the
+// rate bank charges for card operations, cross rate is used for pairs without it
+func (m *MonoConnection) ExchangeRates(ctx context.Context) ([]dto.ExchangeRate, error) {
+	currencies, err := m.client.Currency(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rates := []dto.ExchangeRate{}
+	for _, v := range currencies {
+		rate := v.RateSell
+		if rate == 0 {
+			rate = v.RateCross
+		}
+		if rate == 0 {
+			continue
+		}
+		rates = append(rates, dto.ExchangeRate{
+			From: v.CurrencyCodeA,
+			To:   v.CurrencyCodeB,
+			Rate: rate,
+			Date: time.Unix(v.Date, 0),
+		})
+	}
+	return rates, nil
+}
@@ -0,0 +1,42 @@
+package mono
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	ErrStatementMismatch = errors.New("Webhook statement item differs from statement api")
+	ErrStatementNotFound = errors.New("Webhook statement item not found in statement api")
+	ErrRateLimited       = errors.New("Monobank api rate limit exceeded")
+	ErrUnauthorized      = errors.New("Monobank api token is invalid")
+	ErrBadRequest        = errors.New("Monobank api rejected the request")
+	ErrUnavailable       = errors.New("Monobank api is unavailable")
+	ErrWebhookNotSet     = errors.New("Monobank webhook is not registered")
+)
+
+// APIError is an error response of monobank api
+type APIError struct {
+	Endpoint    string `json:"-"`
+	StatusCode  int    `json:"-"`
+	Description string `json:"errorDescription"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("Monobank api %s responded %d: %s", e.Endpoint, e.StatusCode, e.Description)
+}
+
+// Unwrap makes errors.Is match APIError against the generic errors by status code
+func (e *APIError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden:
+		return ErrUnauthorized
+	case e.StatusCode >= http.StatusInternalServerError:
+		return ErrUnavailable
+	default:
+		return ErrBadRequest
+	}
+}
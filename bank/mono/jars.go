@@ -0,0 +1,271 @@
+package mono
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+	"github.com/sudores/firefly-iii-bank-sync/tracing"
+)
+
+const heldItemsKey = "mono.held_items"
+
+// jarTransfers recognizes movements between cards and jars. Card side item
+// mentions the jar title in description and is emitted as transfer, while the
+// jar side item with the opposite amount is dropped as a duplicate. Jar side
+// items are held for the pair window waiting for the card side one and are
+// emitted as ordinary transactions if it does not come (e.g. top-ups by others).
+// Held items are persisted to store, so they survive restarts
+type jarTransfers struct {
+	mu      sync.Mutex
+	jars    []Jar
+	card    []jarTransfer
+	pending []*pendingJarItem
+	// window - how long sides of transfer are waited for each other, jarPairWindow
+	// if zero. Polled statements are longer apart than webhooks
+	window time.Duration
+
+	// saveMu orders saves of held items
+	saveMu sync.Mutex
+	// timers counts hold timers not stopped, fired ones may be sending held items
+	timers sync.WaitGroup
+}
+
+type jarTransfer struct {
+	jarID  string
+	amount int64
+	time   time.Time
+}
+
+type pendingJarItem struct {
+	jarID  string
+	trans  *dto.TransactionDTO
+	heldAt time.Time
+	timer  *time.Timer
+}
+
+// heldItem is a persisted jar item waiting for the card side of transfer
+type heldItem struct {
+	Transaction *dto.TransactionDTO `json:"transaction"`
+	HeldAt      time.Time           `json:"held_at"`
+}
+
+func (j *jarTransfers) setJars(jars []Jar) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.jars = jars
+}
+
+// setWindow sets how long sides of transfer are waited for each other
+func (j *jarTransfers) setWindow(window time.Duration) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.window = window
+}
+
+// pairWindow must be called with mu held
+func (j *jarTransfers) pairWindow() time.Duration {
+	if j.window == 0 {
+		return jarPairWindow
+	}
+	return j.window
+}
+
+// pollPairWindow returns pair window of statements polled every interval. Statement
+// of one account is requested per api rate limit, so sides of transfer may come
+// a whole poll cycle apart
+func pollPairWindow(interval time.Duration, accounts int) time.Duration {
+	return jarPairWindow + interval + time.Duration(accounts)*apiRateLimit
+}
+
+func (j *jarTransfers) isJar(account string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, v := range j.jars {
+		if v.ID == account {
+			return true
+		}
+	}
+	return false
+}
+
+// matchJar returns id of jar which title is mentioned in description
+func (j *jarTransfers) matchJar(description string) string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	description = strings.ToLower(description)
+	for _, v := range j.jars {
+		if v.Title != "" && strings.Contains(description, strings.ToLower(v.Title)) {
+			return v.ID
+		}
+	}
+	return ""
+}
+
+// emit sends trans to TransactionChan recognizing card and jar transfers.
+// Transaction trace is started here. Returns false when jar item is held
+// waiting for the card side of transfer instead of being sent, with error
+// if the held item is not persisted
+func (m *MonoConnection) emit(ctx context.Context, trans *dto.TransactionDTO) (bool, error) {
+	_, span := tracing.StartTransaction(ctx, sourceName, trans)
+	defer span.End()
+	m.setAccountCurrency(ctx, trans)
+	if m.jars.isJar(trans.AccountID) {
+		m.holdJarItem(trans, time.Now())
+		return false, m.saveHeld()
+	}
+	if jarID := m.jars.matchJar(trans.Transaction.Description); jarID != "" {
+		trans.TransferAccountID = jarID
+		m.addCardTransfer(jarID, trans)
+	}
+	m.TransactionChan <- trans
+	return true, nil
+}
+
+// enqueue emits trans and waits until the pipeline durably records it.
+// Held jar items are waited to be persisted to store
+func (m *MonoConnection) enqueue(ctx context.Context, trans *dto.TransactionDTO) error {
+	enqueued := make(chan error, 1)
+	trans.Enqueued = func(err error) {
+		enqueued <- err
+	}
+	if sent, err := m.emit(ctx, trans); !sent {
+		return err
+	}
+	select {
+	case err := <-enqueued:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// addCardTransfer remembers card side of transfer and drops pending jar side item
+func (m *MonoConnection) addCardTransfer(jarID string, trans *dto.TransactionDTO) {
+	j := &m.jars
+	j.mu.Lock()
+	for i, p := range j.pending {
+		if p.jarID == jarID && p.trans.Transaction.Amount == -trans.Transaction.Amount && p.timer.Stop() {
+			j.timers.Done()
+			log.Debug().Msgf("Jar transaction %s is a part of transfer %s", p.trans.Transaction.ID, trans.Transaction.ID)
+			j.pending = append(j.pending[:i], j.pending[i+1:]...)
+			j.mu.Unlock()
+			m.saveHeld()
+			return
+		}
+	}
+	defer j.mu.Unlock()
+	j.card = append(j.card, jarTransfer{jarID: jarID, amount: trans.Transaction.Amount, time: time.Now()})
+	kept := j.card[:0]
+	for _, v := range j.card {
+		if time.Since(v.time) < j.pairWindow() {
+			kept = append(kept, v)
+		}
+	}
+	j.card = kept
+}
+
+// holdJarItem drops jar side of known transfer, otherwise holds the item till
+// pair window after heldAt
+func (m *MonoConnection) holdJarItem(trans *dto.TransactionDTO, heldAt time.Time) {
+	j := &m.jars
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i, v := range j.card {
+		if v.jarID == trans.AccountID && v.amount == -trans.Transaction.Amount && time.Since(v.time) < j.pairWindow() {
+			log.Debug().Msgf("Jar transaction %s is a part of transfer", trans.Transaction.ID)
+			j.card = append(j.card[:i], j.card[i+1:]...)
+			return
+		}
+	}
+	p := &pendingJarItem{jarID: trans.AccountID, trans: trans, heldAt: heldAt}
+	j.timers.Add(1)
+	p.timer = time.AfterFunc(time.Until(heldAt.Add(j.pairWindow())), func() {
+		defer j.timers.Done()
+		j.mu.Lock()
+		for i, v := range j.pending {
+			if v == p {
+				j.pending = append(j.pending[:i], j.pending[i+1:]...)
+				break
+			}
+		}
+		j.mu.Unlock()
+		m.TransactionChan <- trans
+		m.saveHeld()
+	})
+	j.pending = append(j.pending, p)
+}
+
+// FlushHeld emits jar items waiting for the card side of transfer right away and
+// waits for items of already fired timers, so TransactionChan may be closed after it
+func (m *MonoConnection) FlushHeld() {
+	j := &m.jars
+	j.mu.Lock()
+	held := []*dto.TransactionDTO{}
+	for _, p := range j.pending {
+		if p.timer.Stop() {
+			j.timers.Done()
+			held = append(held, p.trans)
+		}
+	}
+	j.pending = nil
+	j.mu.Unlock()
+	for _, trans := range held {
+		m.TransactionChan <- trans
+	}
+	j.timers.Wait()
+	m.saveHeld()
+}
+
+// saveHeld persists jar items held waiting for the card side of transfer
+func (m *MonoConnection) saveHeld() error {
+	j := &m.jars
+	j.saveMu.Lock()
+	defer j.saveMu.Unlock()
+	j.mu.Lock()
+	held := []heldItem{}
+	for _, p := range j.pending {
+		held = append(held, heldItem{Transaction: p.trans, HeldAt: p.heldAt})
+	}
+	j.mu.Unlock()
+	err := m.store.Set(heldItemsKey, held)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to persist held jar items")
+	}
+	return err
+}
+
+// restoreHeld holds jar items persisted before restart for the rest of their window
+func (m *MonoConnection) restoreHeld() {
+	held := []heldItem{}
+	if _, err := m.store.Get(heldItemsKey, &held); err != nil {
+		log.Warn().Err(err).Msg("Failed to load held jar items")
+		return
+	}
+	for _, v := range held {
+		m.holdJarItem(v.Transaction, v.HeldAt)
+	}
+}
+
+// SavingsGoals returns jars with their goals and refreshes jars used for transfer recognition
+func (m *MonoConnection) SavingsGoals(ctx context.Context) ([]dto.SavingsGoal, error) {
+	info, err := m.client.ClientInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m.refreshAccounts(info)
+	goals := []dto.SavingsGoal{}
+	for _, v := range info.Jars {
+		goals = append(goals, dto.SavingsGoal{
+			AccountID:    v.ID,
+			Name:         v.Title,
+			Goal:         v.Goal,
+			Balance:      v.Balance,
+			CurrencyCode: v.CurrencyCode,
+		})
+	}
+	return goals, nil
+}
@@ -16,19 +16,31 @@ type WebhookStatementItem struct {
 }
 
 func (w *WebhookStatementItem) ToTransactionDTO() *dto.TransactionDTO {
+	return w.Data.StatementItem.ToTransactionDTO(w.Data.Account)
+}
+
+// ToTransactionDTO converts statement item of account to transaction.
+// Operation currency and amount are set as foreign ones
+func (s *StatementItem) ToTransactionDTO(account string) *dto.TransactionDTO {
 	trans := &dto.TransactionDTO{
-		AccountID: w.Data.Account,
+		AccountID: account,
 		Transaction: dto.TransactionDTOTransaction{
-			ID:           w.Data.StatementItem.ID,
-			Amount:       w.Data.StatementItem.Amount,
-			Comment:      w.Data.StatementItem.Comment,
-			MCC:          w.Data.StatementItem.MCC,
-			Description:  w.Data.StatementItem.Description,
-			CurrencyCode: w.Data.StatementItem.CurrencyCode,
-			CounterIban:  w.Data.StatementItem.CounterIban,
-			CounterName:  w.Data.StatementItem.CounterName,
+			ID:           s.ID,
+			Amount:       s.Amount,
+			Comment:      s.Comment,
+			MCC:          s.MCC,
+			Description:  s.Description,
+			CurrencyCode: s.CurrencyCode,
+			CounterIban:  s.CounterIban,
+			CounterName:  s.CounterName,
+			Balance:      int64(s.Balance),
+
+			CounterEdrpou: s.CounterEdrpou,
+
+			ForeignAmount:       s.OperationAmount,
+			ForeignCurrencyCode: s.CurrencyCode,
 		}}
-	trans.Transaction.Time = time.Unix(w.Data.StatementItem.Time, 0)
+	trans.Transaction.Time = time.Unix(s.Time, 0)
 	return trans
 }
 
@@ -53,3 +65,45 @@ type StatementItem struct {
 	CounterIban     string `json:"counterIban"`
 	CounterName     string `json:"counterName"`
 }
+
+// ClientInfo according to https://api.monobank.ua/docs/#tag/Kliyentski-personalni-dani/paths/~1personal~1client-info/get
+type ClientInfo struct {
+	ClientID    string    `json:"clientId"`
+	Name        string    `json:"name"`
+	WebHookURL  string    `json:"webHookUrl"`
+	Permissions string    `json:"permissions"`
+	Accounts    []Account `json:"accounts"`
+	Jars        []Jar     `json:"jars"`
+}
+
+type Account struct {
+	ID           string   `json:"id"`
+	SendID       string   `json:"sendId"`
+	Balance      int64    `json:"balance"`
+	CreditLimit  int64    `json:"creditLimit"`
+	Type         string   `json:"type"`
+	CurrencyCode int32    `json:"currencyCode"`
+	CashbackType string   `json:"cashbackType"`
+	MaskedPan    []string `json:"maskedPan"`
+	Iban         string   `json:"iban"`
+}
+
+type Jar struct {
+	ID           string `json:"id"`
+	SendID       string `json:"sendId"`
+	Title        string `json:"title"`
+	Description  string `json:"description"`
+	CurrencyCode int32  `json:"currencyCode"`
+	Balance      int64  `json:"balance"`
+	Goal         int64  `json:"goal"`
+}
+
+// CurrencyInfo according to https://api.monobank.ua/docs/#tag/Publichni-dani/paths/~1bank~1currency/get
+type CurrencyInfo struct {
+	CurrencyCodeA int32   `json:"currencyCodeA"`
+	CurrencyCodeB int32   `json:"currencyCodeB"`
+	Date          int64   `json:"date"`
+	RateSell      float64 `json:"rateSell"`
+	RateBuy       float64 `json:"rateBuy"`
+	RateCross     float64 `json:"rateCross"`
+}
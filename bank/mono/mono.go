@@ -1,121 +1,236 @@
 package mono
 
 import (
-	"bytes"
 	"context"
-	"crypto/rand"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"math/big"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+	"github.com/sudores/firefly-iii-bank-sync/store"
+	"github.com/sudores/firefly-iii-bank-sync/tracing"
 	"github.com/sudores/firefly-iii-bank-sync/util"
+	"go.opentelemetry.io/otel/trace"
 )
 
+const (
+	// ModeWebhook - transactions are pushed by monobank webhook, statements are polled
+	// only while webhook is unavailable
+	ModeWebhook = "webhook"
+	// ModePolling - transactions are got by statement polling only, no public url required
+	ModePolling = "polling"
+)
+
+// Options of MonoConnection
+type Options struct {
+	Mode string
+
+	// FBSHost - public url webhook is served on
+	FBSHost          string
+	WebhookPath      string
+	WatchdogInterval time.Duration
+	Auth             WebhookAuth
+
+	PollInterval time.Duration
+	// PollAccounts - accounts to poll, all client accounts are polled when empty
+	PollAccounts []string
+}
+
 type MonoConnection struct {
 	TransactionChan chan *dto.TransactionDTO
 
-	monoAPIURL   string
-	monoAPIToken string
-
-	srv *http.Server
+	client *Client
 
+	mode       string
 	fBSHost    string
 	fBSURLPath string
+
+	auth              WebhookAuth
+	watchdogInterval  time.Duration
+	webhookRegistered atomic.Bool
+	// lastWebhook - unix time of the last webhook transaction receipt
+	lastWebhook atomic.Int64
+	seen        *seenItems
+	jars        jarTransfers
+
+	// currencies of accounts and jars by id
+	currenciesMu sync.Mutex
+	currencies   map[string]int32
+
+	pollInterval time.Duration
+	pollAccounts []string
+
+	store  *store.Store
+	ctx    context.Context
+	cancel context.CancelFunc
+	// wg - background goroutines emitting transactions, waited on shutdown
+	wg sync.WaitGroup
 }
 
-func NewMonoConnetion(APIToken, FBSHost, listenAddr string) *MonoConnection {
+func NewMonoConnetion(client *Client, st *store.Store, opts Options) (*MonoConnection, error) {
+	seen, err := newSeenItems(st)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
 	return &MonoConnection{
-		monoAPIURL:      monoAPIURL,
-		monoAPIToken:    APIToken,
-		srv:             &http.Server{Addr: listenAddr},
-		fBSHost:         FBSHost,
-		fBSURLPath:      "/" + getPathSuffix(),
-		TransactionChan: make(chan *dto.TransactionDTO, 2),
+		ctx:              ctx,
+		cancel:           cancel,
+		store:            st,
+		seen:             seen,
+		currencies:       map[string]int32{},
+		mode:             opts.Mode,
+		auth:             opts.Auth,
+		watchdogInterval: opts.WatchdogInterval,
+		pollInterval:     opts.PollInterval,
+		pollAccounts:     opts.PollAccounts,
+		client:           client,
+		fBSHost:          opts.FBSHost,
+		fBSURLPath:       opts.WebhookPath,
+		TransactionChan:  make(chan *dto.TransactionDTO, 2),
+	}, nil
+}
+
+// Serve restores jar items held before restart and starts statement polling in
+// polling mode. Otherwise webhook handler is registered on http.DefaultServeMux
+// and webhook watchdog is started
+func (m *MonoConnection) Serve() {
+	if m.mode == ModePolling {
+		// Refined by poll once accounts are known
+		m.jars.setWindow(pollPairWindow(m.pollInterval, len(m.pollAccounts)))
+	}
+	m.restoreHeld()
+	if m.mode == ModePolling {
+		log.Info().Msg("Mono starting statement polling")
+		m.goBackground(m.poll)
+		return
+	}
+
+	log.Debug().Msg("Setting up handlers")
+	log.Info().Msgf("Your host is %s", m.fBSHost)
+	log.Debug().Msgf("Your url is %s", m.fBSHost+m.fBSURLPath)
+	http.HandleFunc(m.fBSURLPath, m.authenticate(m.processWebhook))
+	if m.auth.Secret != "" {
+		http.HandleFunc(m.fBSURLPath+"/", m.authenticate(m.processWebhook))
 	}
+	m.goBackground(m.watchdog)
 }
 
-func (m *MonoConnection) Serve() error {
+// goBackground runs fn in goroutine waited by Shutdown
+func (m *MonoConnection) goBackground(fn func()) {
+	m.wg.Add(1)
 	go func() {
-		log.Debug().Msg("Setting up webhook")
-		if err := m.webhookSetup(); err != nil {
-			log.Fatal().Err(err).Msg("Failed to setup webhook")
-		}
-		log.Debug().Msg("Mono webhook was setup")
+		defer m.wg.Done()
+		fn()
 	}()
+}
 
-	log.Debug().Msg("Setting up handlers")
-	log.Info().Msgf("Your url is %s", m.fBSHost+m.fBSURLPath)
-	http.HandleFunc(m.fBSURLPath, func(w http.ResponseWriter, r *http.Request) {
-		if r.ContentLength == 0 && r.Method == http.MethodGet { // TODO: Move to the separate function
-			fmt.Fprint(w, "")
-			return
-		}
-		if r.Method != http.MethodPost {
-			log.Warn().Msg("Bad request received")
-			http.Error(w, "Bad request POST and GET only are accepted", http.StatusBadRequest)
-			return
-		}
-		wst := WebhookStatementItem{}
-		if err := util.HttpRequestToStruct(r, &wst); err != nil {
-			http.Error(w, "Failed to unmarshal json", http.StatusBadRequest)
-			return
-		}
-		log.Debug().Msg("Transaction received")
-		m.TransactionChan <- wst.ToTransactionDTO()
-		fmt.Fprint(w, "Transaction received")
+// WebhookStatus reports whether webhook is registered in monobank
+func (m *MonoConnection) WebhookStatus() (string, error) {
+	if m.mode == ModePolling {
+		return ModePolling, nil
+	}
+	if !m.webhookRegistered.Load() {
+		return "", ErrWebhookNotSet
+	}
+	return "registered", nil
+}
 
-	})
-	log.Info().Msg("Mono starting serving")
-	return m.srv.ListenAndServe()
+// LastWebhook returns time of the last transaction received by webhook, zero if none
+func (m *MonoConnection) LastWebhook() time.Time {
+	if v := m.lastWebhook.Load(); v != 0 {
+		return time.Unix(v, 0)
+	}
+	return time.Time{}
+}
+
+// QueueDepth returns number of transactions waiting to be passed on
+func (m *MonoConnection) QueueDepth() int {
+	return len(m.TransactionChan)
 }
 
-func (m *MonoConnection) Shutdown(ctx context.Context) error {
+// Shutdown stops polling, watchdog and statement verification and waits for them.
+// Jar items waiting for the card side of transfer are emitted, so TransactionChan
+// must be read until Shutdown returns. Webhook handler is stopped with the listener
+func (m *MonoConnection) Shutdown() {
+	m.cancel()
+	m.wg.Wait()
+	m.FlushHeld()
 	log.Info().Msg("Shutting down mono connection. Bye!!!")
-	return m.srv.Shutdown(ctx)
+}
+
+func (m *MonoConnection) processWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.ContentLength == 0 && r.Method == http.MethodGet {
+		fmt.Fprint(w, "")
+		return
+	}
+	if r.Method != http.MethodPost {
+		log.Warn().Msg("Bad request received")
+		http.Error(w, "Bad request POST and GET only are accepted", http.StatusBadRequest)
+		return
+	}
+	m.processWebhookStatementItemPost(w, r)
 }
 
 func (m *MonoConnection) processWebhookStatementItemPost(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartSpan(r.Context(), sourceName+".webhook")
+	defer span.End()
 	wst := WebhookStatementItem{}
 	if err := util.HttpRequestToStruct(r, &wst); err != nil {
 		http.Error(w, "Failed to unmarshal json", http.StatusBadRequest)
 		return
 	}
-	m.TransactionChan <- wst.ToTransactionDTO()
 	log.Debug().Msg("Transaction received")
-	fmt.Fprint(w, "Transaction received")
-}
-
-func (m *MonoConnection) webhookSetup() error {
-	m.checkServeStatus()
-	webhook, err := json.Marshal(struct {
-		WebHookUrl string `json:"webHookUrl"`
-	}{WebHookUrl: m.fBSHost + m.fBSURLPath})
-	cl := &http.Client{Timeout: time.Second * 30}
-	req, err := http.NewRequest(http.MethodPost, m.monoAPIURL+monoWebhookAPIPath, bytes.NewReader(webhook))
-	if err != nil {
-		return err
-	}
-
-	req.Header.Add("X-Token", m.monoAPIToken)
-	resp, err := cl.Do(req)
-	if err != nil {
-		return err
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return err
+	m.lastWebhook.Store(time.Now().Unix())
+	if !m.seen.add(wst.Data.StatementItem.ID, time.Unix(wst.Data.StatementItem.Time, 0)) {
+		log.Debug().Msgf("Transaction %s was already received", wst.Data.StatementItem.ID)
+		fmt.Fprint(w, "Transaction received")
+		return
 	}
-	if resp.StatusCode != http.StatusOK {
-		return errors.New(fmt.Sprintf("Failed to setup webhook %d. API respond %s", resp.StatusCode, string(body)))
+	m.seen.save()
+	if !m.auth.VerifyStatement {
+		// Receipt is acknowledged once the transaction is recorded, so monobank
+		// retries the webhook otherwise
+		if err := m.enqueue(ctx, wst.ToTransactionDTO()); err != nil {
+			log.Error().Err(err).Msgf("Failed to enqueue transaction with id: %s", wst.Data.StatementItem.ID)
+			m.seen.remove(wst.Data.StatementItem.ID)
+			http.Error(w, "Failed to enqueue transaction", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, "Transaction received")
+		return
 	}
-	return nil
+	// Verification takes longer than monobank waits for response
+	ctx = trace.ContextWithSpanContext(m.ctx, span.SpanContext())
+	m.goBackground(func() {
+		err := m.verifyStatementItem(ctx, wst.Data.Account, wst.Data.StatementItem)
+		switch {
+		case err == nil:
+		case m.ctx.Err() != nil:
+			// Unverified item is never recorded. It is not remembered as seen,
+			// so statement polling or backfill picks it up after restart
+			log.Warn().Msgf("Verification of transaction %s is interrupted by shutdown", wst.Data.StatementItem.ID)
+			m.seen.remove(wst.Data.StatementItem.ID)
+			return
+		case errors.Is(err, ErrStatementMismatch):
+			log.Warn().Err(err).Msgf("Rejecting transaction with id: %s", wst.Data.StatementItem.ID)
+			return
+		default:
+			// Item is not remembered as seen, so statement polling or backfill picks it up
+			log.Warn().Err(err).Msgf("Failed to verify transaction with id: %s", wst.Data.StatementItem.ID)
+			m.seen.remove(wst.Data.StatementItem.ID)
+			return
+		}
+		if _, err := m.emit(ctx, wst.ToTransactionDTO()); err != nil {
+			log.Error().Err(err).Msgf("Failed to hold transaction with id: %s", wst.Data.StatementItem.ID)
+		}
+	})
+	fmt.Fprint(w, "Transaction received")
 }
 
 func (m *MonoConnection) checkServeStatus() {
@@ -123,7 +238,7 @@ func (m *MonoConnection) checkServeStatus() {
 	cl := &http.Client{Timeout: time.Second * 5}
 	for {
 		time.Sleep(time.Second * 2)
-		resp, err := cl.Get(m.fBSHost + m.fBSURLPath)
+		resp, err := cl.Get(m.WebhookURL())
 		if err != nil {
 			return
 		}
@@ -137,17 +252,3 @@ func (m *MonoConnection) checkServeStatus() {
 	}
 
 }
-
-func getPathSuffix() string {
-	mbPathLength := 32
-	var res []byte
-	for i := 0; i <= mbPathLength; i++ {
-		char := []byte("abcdefghijklmnopqrstuvwxyz1234567890")
-		k, err := rand.Int(rand.Reader, big.NewInt(int64(len(char))))
-		if err != nil {
-			panic(err)
-		}
-		res = append(res, char[k.Int64()])
-	}
-	return string(res)
-}
@@ -0,0 +1,51 @@
+package mono
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+
+	"github.com/sudores/firefly-iii-bank-sync/store"
+)
+
+const webhookPathKey = "mono.webhook_path"
+
+// WebhookPath returns configured path if set. Otherwise the path persisted in st is used,
+// new one is generated and persisted on the first start
+func WebhookPath(st *store.Store, configured string) (string, error) {
+	if configured != "" {
+		return "/" + strings.TrimPrefix(configured, "/"), nil
+	}
+	path := ""
+	ok, err := st.Get(webhookPathKey, &path)
+	if err != nil {
+		return "", err
+	}
+	if ok && path != "" {
+		return path, nil
+	}
+	return RotateWebhookPath(st)
+}
+
+// RotateWebhookPath generates new path and persists it in st
+func RotateWebhookPath(st *store.Store) (string, error) {
+	path := "/" + getPathSuffix()
+	if err := st.Set(webhookPathKey, path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func getPathSuffix() string {
+	mbPathLength := 32
+	var res []byte
+	for i := 0; i <= mbPathLength; i++ {
+		char := []byte("abcdefghijklmnopqrstuvwxyz1234567890")
+		k, err := rand.Int(rand.Reader, big.NewInt(int64(len(char))))
+		if err != nil {
+			panic(err)
+		}
+		res = append(res, char[k.Int64()])
+	}
+	return string(res)
+}
@@ -0,0 +1,126 @@
+package mono
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const pollCursorsKey = "mono.poll_cursors"
+
+// poll requests statements of accounts every pollInterval until connection is shut down.
+// Each account is polled from its persisted cursor with pollOverlap, as items may
+// appear in statement with delay. Already seen items are not emitted twice
+func (m *MonoConnection) poll() {
+	cursors := map[string]time.Time{}
+	if _, err := m.store.Get(pollCursorsKey, &cursors); err != nil {
+		log.Warn().Err(err).Msg("Failed to load statement poll cursors")
+	}
+	for {
+		accounts, err := m.accountsToPoll(nil)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to get accounts to poll")
+		}
+		m.jars.setWindow(pollPairWindow(m.pollInterval, len(accounts)))
+		for _, account := range accounts {
+			now := time.Now()
+			since, ok := cursors[account]
+			if !ok {
+				// Do not import the history on the first start
+				since = now
+			}
+			until, err := m.pollAccount(account, since, now)
+			if m.ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				log.Warn().Err(err).Msgf("Failed to poll statement of account %s", account)
+			}
+			if until.Equal(since) {
+				continue
+			}
+			cursors[account] = until
+			if err := m.store.Set(pollCursorsKey, cursors); err != nil {
+				log.Warn().Err(err).Msg("Failed to persist statement poll cursors")
+			}
+		}
+
+		select {
+		case <-m.ctx.Done():
+			log.Info().Msg("Mono statement polling stopped")
+			return
+		case <-time.After(m.pollInterval):
+		}
+	}
+}
+
+// pollAccount emits not seen statement items of account since the cursor with
+// pollOverlap until now. The range is requested in statementMaxRange windows, so
+// polling catches up after a downtime longer than a single request allows.
+// Returns the cursor next poll should start from
+func (m *MonoConnection) pollAccount(account string, cursor, now time.Time) (time.Time, error) {
+	for start := cursor.Add(-pollOverlap); start.Before(now); start = start.Add(statementMaxRange) {
+		end := start.Add(statementMaxRange)
+		if end.After(now) {
+			end = now
+		}
+		items, err := m.client.Statement(m.ctx, account, start, end)
+		if err != nil {
+			// Items are emitted until the start of the failed window
+			return start.Add(pollOverlap), err
+		}
+		m.emitStatementItems(account, items)
+	}
+	return now, nil
+}
+
+// accountsToPoll returns configured accounts or all accounts and jars of info.
+// Info is fetched when nil, given one is expected to be applied by caller
+func (m *MonoConnection) accountsToPoll(info *ClientInfo) ([]string, error) {
+	if len(m.pollAccounts) != 0 {
+		return m.pollAccounts, nil
+	}
+	if info == nil {
+		var err error
+		if info, err = m.client.ClientInfo(m.ctx); err != nil {
+			return nil, err
+		}
+		m.refreshAccounts(info)
+	}
+	accounts := []string{}
+	for _, v := range info.Accounts {
+		accounts = append(accounts, v.ID)
+	}
+	for _, v := range info.Jars {
+		accounts = append(accounts, v.ID)
+	}
+	return accounts, nil
+}
+
+// Backfill emits statement items of account in the time range including already
+// seen ones. Firefly-iii rejects the ones created before as duplicates. Items are
+// not marked as seen, so backfill does not affect statement polling
+func (m *MonoConnection) Backfill(ctx context.Context, account string, from, to time.Time) error {
+	for start := from; start.Before(to); start = start.Add(statementMaxRange) {
+		end := start.Add(statementMaxRange)
+		if end.After(to) {
+			end = to
+		}
+		items, err := m.client.Statement(ctx, account, start, end)
+		if err != nil {
+			return err
+		}
+		log.Info().Msgf("Backfilling %d transactions of account %s from %s", len(items), account, start.Format(time.DateOnly))
+		sort.Slice(items, func(i, j int) bool { return items[i].Time < items[j].Time })
+		for i := range items {
+			// Items not emitted before shutdown are left to the next backfill
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			m.emit(ctx, items[i].ToTransactionDTO(account))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package mono
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+	"github.com/sudores/firefly-iii-bank-sync/store"
+)
+
+// newTestConnection returns polling connection of fake api with account acc known
+func newTestConnection(t *testing.T, url string) *MonoConnection {
+	st, err := store.Open(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newTestClient(url, monoStatementAPIPath, monoClientInfoAPIPath)
+	m, err := NewMonoConnetion(client, st, Options{Mode: ModePolling, PollInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.currencies["acc"] = 980
+	// Emitted items are read after polling
+	m.TransactionChan = make(chan *dto.TransactionDTO, 10)
+	return m
+}
+
+func TestPollAccountAfterLongDowntime(t *testing.T) {
+	now := time.Now()
+	cursor := now.Add(-40 * 24 * time.Hour)
+	all := []StatementItem{
+		{ID: "old", Time: now.Add(-39 * 24 * time.Hour).Unix()},
+		{ID: "middle", Time: now.Add(-10 * 24 * time.Hour).Unix()},
+		{ID: "new", Time: now.Add(-time.Minute).Unix()},
+	}
+	var mu sync.Mutex
+	failFrom := int64(0)
+	ranges := [][2]int64{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var from, to int64
+		fmt.Sscanf(strings.TrimPrefix(r.URL.Path, monoStatementAPIPath+"/acc/"), "%d/%d", &from, &to)
+		mu.Lock()
+		defer mu.Unlock()
+		ranges = append(ranges, [2]int64{from, to})
+		if to-from > int64(statementMaxRange/time.Second) || failFrom != 0 && from >= failFrom {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"errorDescription": "Period must be no more than 31 days"}`)
+			return
+		}
+		page := []StatementItem{}
+		for _, v := range all {
+			if v.Time >= from && v.Time <= to {
+				page = append(page, v)
+			}
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	defer srv.Close()
+
+	m := newTestConnection(t, srv.URL)
+	until, err := m.pollAccount("acc", cursor, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !until.Equal(now) {
+		t.Errorf("cursor = %s, want %s", until, now)
+	}
+	for _, want := range []string{"old", "middle", "new"} {
+		if trans := <-m.TransactionChan; trans.Transaction.ID != want {
+			t.Errorf("emitted %s, want %s", trans.Transaction.ID, want)
+		}
+	}
+	// The range is covered by adjacent windows starting pollOverlap before the cursor
+	if len(ranges) != 2 || ranges[0][0] != cursor.Add(-pollOverlap).Unix() || ranges[0][1] != ranges[1][0] ||
+		ranges[1][1] != now.Unix() {
+		t.Errorf("requested ranges %v", ranges)
+	}
+
+	// Cursor is moved to the start of the failed window
+	m = newTestConnection(t, srv.URL)
+	second := cursor.Add(-pollOverlap).Add(statementMaxRange)
+	failFrom = second.Unix()
+	until, err = m.pollAccount("acc", cursor, now)
+	if err == nil {
+		t.Error("failed window is not reported")
+	}
+	if want := second.Add(pollOverlap); !until.Equal(want) {
+		t.Errorf("cursor = %s, want %s", until, want)
+	}
+	for _, want := range []string{"old", "middle"} {
+		if trans := <-m.TransactionChan; trans.Transaction.ID != want {
+			t.Errorf("emitted %s, want %s", trans.Transaction.ID, want)
+		}
+	}
+	if len(m.TransactionChan) != 0 {
+		t.Errorf("%d items of the failed window are emitted", len(m.TransactionChan))
+	}
+}
@@ -0,0 +1,71 @@
+package mono
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sudores/firefly-iii-bank-sync/store"
+)
+
+const seenItemsKey = "mono.seen_items"
+
+// seenItems remembers ids of statement items already emitted, so items
+// received both with webhook and statement polling are emitted once.
+// Ids are persisted to store to survive restarts
+type seenItems struct {
+	st *store.Store
+	// saveMu keeps snapshots written in the order they are taken
+	saveMu sync.Mutex
+
+	mu    sync.Mutex
+	items map[string]time.Time
+}
+
+func newSeenItems(st *store.Store) (*seenItems, error) {
+	s := &seenItems{st: st, items: map[string]time.Time{}}
+	if _, err := st.Get(seenItemsKey, &s.items); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// add marks id as seen and reports whether it was not seen before.
+// Ids are persisted by save
+func (s *seenItems) add(id string, t time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.items[id]; ok {
+		return false
+	}
+	s.items[id] = t
+	return true
+}
+
+// remove forgets id, so the item is emitted when received again
+func (s *seenItems) remove(id string) {
+	s.mu.Lock()
+	delete(s.items, id)
+	s.mu.Unlock()
+	s.save()
+}
+
+// save drops ids older than statement range, which are not polled anymore,
+// and persists the rest. Store is written outside of the lock of items
+func (s *seenItems) save() {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	s.mu.Lock()
+	items := make(map[string]time.Time, len(s.items))
+	for k, v := range s.items {
+		if time.Since(v) > statementMaxRange {
+			delete(s.items, k)
+			continue
+		}
+		items[k] = v
+	}
+	s.mu.Unlock()
+	if err := s.st.Set(seenItemsKey, items); err != nil {
+		log.Warn().Err(err).Msg("Failed to persist seen statement items")
+	}
+}
@@ -1,6 +1,34 @@
 package mono
 
+import "time"
+
 const (
-	monoAPIURL         string = "https://api.monobank.ua/personal"
-	monoWebhookAPIPath string = "/webhook"
+	// sourceName - name of the source in metrics and traces
+	sourceName = "monobank"
+
+	monoWebhookAPIPath    string = "/personal/webhook"
+	monoStatementAPIPath  string = "/personal/statement"
+	monoClientInfoAPIPath string = "/personal/client-info"
+	monoCurrencyAPIPath   string = "/bank/currency"
+
+	// apiRateLimit - monobank allows one request per endpoint per minute
+	apiRateLimit = time.Second * 61
+
+	statementVerifyAttempts = 3
+	// statementMaxRange - max time range of single statement request
+	statementMaxRange = time.Hour * 24 * 31
+	// statementPageSize - max number of items monobank returns per statement request
+	statementPageSize = 500
+
+	// pollOverlap - how far before the last poll next poll starts
+	pollOverlap = time.Hour
+
+	// jarPairWindow - how long card and jar sides of transfer are waited for each other
+	jarPairWindow = time.Minute * 2
+
+	// accountsFetchTimeout - how long transaction waits for accounts when its account currency is unknown
+	accountsFetchTimeout = time.Second * 5
+
+	webhookMinBackoff = time.Minute
+	webhookMaxBackoff = time.Minute * 30
 )
@@ -0,0 +1,120 @@
+package mono
+
+import (
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// watchdog registers webhook and periodically checks it is still registered in monobank.
+// While webhook is unavailable transactions are got by statement polling
+func (m *MonoConnection) watchdog() {
+	log.Debug().Msg("Setting up webhook")
+	m.checkServeStatus()
+	m.recoverWebhook(time.Now(), nil)
+
+	ticker := time.NewTicker(m.watchdogInterval)
+	defer ticker.Stop()
+	lastHealthy := time.Now()
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		info, err := m.client.ClientInfo(m.ctx)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to check webhook registration")
+			continue
+		}
+		m.refreshAccounts(info)
+		if info.WebHookURL == m.WebhookURL() {
+			lastHealthy = time.Now()
+			continue
+		}
+		log.Warn().Msg("Webhook is not registered in monobank anymore. Re-registering")
+		m.webhookRegistered.Store(false)
+		m.recoverWebhook(lastHealthy, info)
+		lastHealthy = time.Now()
+	}
+}
+
+// recoverWebhook registers webhook retrying with backoff. Statements since
+// the webhook was known to work are polled until registration succeeds.
+// info is client info just fetched, nil if none
+func (m *MonoConnection) recoverWebhook(since time.Time, info *ClientInfo) {
+	backoff := webhookMinBackoff
+	failed := false
+	for {
+		err := m.client.SetWebhook(m.ctx, m.WebhookURL())
+		if err == nil {
+			break
+		}
+		failed = true
+		log.Warn().Err(err).Msgf("Failed to setup webhook. Retrying in %s", backoff)
+		since = m.pollStatements(since, backoff, info)
+		// Accounts are fetched again on the next attempts
+		info = nil
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > webhookMaxBackoff {
+			backoff = webhookMaxBackoff
+		}
+	}
+	log.Info().Msg("Mono webhook was setup")
+	m.webhookRegistered.Store(true)
+	// Covers the gap between the last poll and the registration
+	if failed || time.Since(since) > m.watchdogInterval {
+		m.pollStatements(since, 0, info)
+	}
+	m.jars.setWindow(jarPairWindow)
+}
+
+// pollStatements emits not seen statement items of all accounts since the given time.
+// Next poll is expected in interval. Accounts are taken from info unless it is nil.
+// Returns the time next poll should start from
+func (m *MonoConnection) pollStatements(since time.Time, interval time.Duration, info *ClientInfo) time.Time {
+	accounts, err := m.accountsToPoll(info)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to get accounts for statement polling")
+		return since
+	}
+	m.jars.setWindow(pollPairWindow(interval, len(accounts)))
+	now := time.Now()
+	if now.Sub(since) > statementMaxRange {
+		since = now.Add(-statementMaxRange)
+	}
+	next := now
+	for _, account := range accounts {
+		items, err := m.client.Statement(m.ctx, account, since, now)
+		if err != nil {
+			log.Warn().Err(err).Msgf("Failed to poll statement of account %s", account)
+			next = since
+			continue
+		}
+		m.emitStatementItems(account, items)
+	}
+	return next
+}
+
+// emitStatementItems sends not seen items to TransactionChan from the oldest to the newest.
+// Seen ids are persisted once per statement
+func (m *MonoConnection) emitStatementItems(account string, items []StatementItem) {
+	sort.Slice(items, func(i, j int) bool { return items[i].Time < items[j].Time })
+	added := false
+	for i := range items {
+		if !m.seen.add(items[i].ID, time.Unix(items[i].Time, 0)) {
+			continue
+		}
+		added = true
+		log.Debug().Msgf("Transaction %s received by statement polling", items[i].ID)
+		m.emit(m.ctx, items[i].ToTransactionDTO(account))
+	}
+	if added {
+		m.seen.save()
+	}
+}
@@ -0,0 +1,9 @@
+package sms
+
+import "errors"
+
+var (
+	ErrNoTemplateMatched = errors.New("No sms template matched the notification text")
+	ErrBadAmount         = errors.New("Failed to parse amount from the notification text")
+	ErrUnknownCurrency   = errors.New("Failed to recognize currency of the notification")
+)
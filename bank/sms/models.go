@@ -0,0 +1,97 @@
+package sms
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	directionDebit  = "debit"
+	directionCredit = "credit"
+)
+
+// Template describes a single notification format of a bank.
+// Pattern is a regular expression with named groups. Recognized group names are
+// amount (required), currency, merchant, card, balance and direction
+type Template struct {
+	Name    string `json:"name"`
+	Bank    string `json:"bank"`
+	Pattern string `json:"pattern"`
+	// Direction - debit or credit. If empty the direction group or the sign of
+	// the amount is used, debit is assumed otherwise
+	Direction string `json:"direction"`
+	// Currency - used when template has no currency group
+	Currency string `json:"currency"`
+	// CreditWords - values of the direction group treated as credit
+	CreditWords []string `json:"credit_words"`
+
+	re *regexp.Regexp
+}
+
+// Match holds the values extracted from notification text by a template
+type Match struct {
+	Template  *Template
+	Amount    string
+	Currency  string
+	Merchant  string
+	Card      string
+	Balance   string
+	Direction string
+}
+
+func (t *Template) compile() error {
+	re, err := regexp.Compile(t.Pattern)
+	if err != nil {
+		return err
+	}
+	t.re = re
+	return nil
+}
+
+func (t *Template) match(text string) *Match {
+	sub := t.re.FindStringSubmatch(text)
+	if sub == nil {
+		return nil
+	}
+	m := &Match{Template: t, Currency: t.Currency, Direction: t.Direction}
+	for i, name := range t.re.SubexpNames() {
+		if sub[i] == "" {
+			continue
+		}
+		switch name {
+		case "amount":
+			m.Amount = sub[i]
+		case "currency":
+			m.Currency = sub[i]
+		case "merchant":
+			m.Merchant = sub[i]
+		case "card":
+			m.Card = sub[i]
+		case "balance":
+			m.Balance = sub[i]
+		case "direction":
+			m.Direction = directionDebit
+			for _, w := range t.CreditWords {
+				if strings.EqualFold(w, sub[i]) {
+					m.Direction = directionCredit
+				}
+			}
+		}
+	}
+	return m
+}
+
+// LoadTemplates reads templates from json file with an array of Template objects
+func LoadTemplates(path string) ([]Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	templates := []Template{}
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
@@ -0,0 +1,359 @@
+package sms
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/rmg/iso4217"
+	"github.com/rs/zerolog/log"
+	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+)
+
+// SMSConnection turns raw sms or push notification text into transactions
+type SMSConnection struct {
+	TransactionChan chan *dto.TransactionDTO
+
+	templatesMu sync.RWMutex
+	templates   []Template
+	webhookPath string
+	// webhookSecret - required in X-FBS-Secret header or as the last path segment
+	webhookSecret string
+	filePath      string
+}
+
+// NewSMSConnection builds connection with templates from templatesFile (if set)
+// followed by the built-in ones
+func NewSMSConnection(templatesFile, webhookPath, webhookSecret, filePath string) (*SMSConnection, error) {
+	templates, err := NewTemplates(templatesFile)
+	if err != nil {
+		return nil, err
+	}
+	return &SMSConnection{
+		TransactionChan: make(chan *dto.TransactionDTO, 2),
+		templates:       templates,
+		webhookPath:     webhookPath,
+		webhookSecret:   webhookSecret,
+		filePath:        filePath,
+	}, nil
+}
+
+// NewTemplates returns compiled user templates from templatesFile and the built-in ones
+func NewTemplates(templatesFile string) ([]Template, error) {
+	templates := []Template{}
+	if templatesFile != "" {
+		userTemplates, err := LoadTemplates(templatesFile)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, userTemplates...)
+	}
+	return CompileTemplates(templates)
+}
+
+// CompileTemplates returns compiled templates followed by the built-in ones
+func CompileTemplates(templates []Template) ([]Template, error) {
+	templates = append(append([]Template{}, templates...), builtinTemplates...)
+	for i := range templates {
+		if err := templates[i].compile(); err != nil {
+			return nil, fmt.Errorf("Failed to compile sms template %q: %w", templates[i].Name, err)
+		}
+	}
+	return templates, nil
+}
+
+// Serve registers the webhook handler and imports notifications from file if configured.
+// The handler is registered on http.DefaultServeMux served by the app listener
+func (s *SMSConnection) Serve() error {
+	if s.webhookPath != "" {
+		log.Debug().Msgf("Setting up sms handler on %s", s.webhookPath)
+		http.HandleFunc(s.webhookPath, s.processNotificationPost)
+		http.HandleFunc(strings.TrimSuffix(s.webhookPath, "/")+"/", s.processNotificationPost)
+	}
+	if s.filePath != "" {
+		log.Info().Msgf("Importing sms notifications from %s", s.filePath)
+		if err := s.ImportFile(s.filePath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SMSConnection) processNotificationPost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Bad request POST only is accepted", http.StatusBadRequest)
+		return
+	}
+	if !s.validSecret(r) {
+		log.Warn().Msgf("Sms webhook request with invalid secret from %s", r.RemoteAddr)
+		http.NotFound(w, r)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+	text, t := splitTime(string(body), time.Now())
+	trans, err := s.ToTransactionDTO(text, t)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to parse sms notification")
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	s.TransactionChan <- trans
+	log.Debug().Msg("Sms transaction received")
+	fmt.Fprint(w, "Transaction received")
+}
+
+// splitTime returns notification text and the time sent by the sender on its first
+// line, as in SMS_FILE. Ids of timed notifications do not depend on the time they
+// are received, so retries of the sender are deduplicated. received is used otherwise
+func splitTime(body string, received time.Time) (string, time.Time) {
+	line, text, ok := strings.Cut(strings.TrimSpace(body), "\n")
+	if !ok {
+		return body, received
+	}
+	t, ok := parseTime(strings.TrimSpace(line))
+	if !ok {
+		return body, received
+	}
+	return strings.TrimSpace(text), t
+}
+
+func (s *SMSConnection) validSecret(r *http.Request) bool {
+	secret := r.Header.Get("X-FBS-Secret")
+	if secret == "" {
+		secret = strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(s.webhookPath, "/")+"/")
+	}
+	return secret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(s.webhookSecret)) == 1
+}
+
+// ImportFile reads notifications separated by empty lines and sends them to TransactionChan.
+// See ParseNotifications for the file format
+func (s *SMSConnection) ImportFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	s.templatesMu.RLock()
+	templates := s.templates
+	s.templatesMu.RUnlock()
+	transactions, err := ParseNotifications(templates, f, info.ModTime())
+	if err != nil {
+		return err
+	}
+	for _, trans := range transactions {
+		s.TransactionChan <- trans
+	}
+	return nil
+}
+
+// ParseNotifications parses notifications separated by empty lines with templates.
+// The first line of notification may hold its time, modTime is used otherwise.
+// Ids of notifications without time do not depend on it, so the file may be
+// imported again after notifications are appended. Unmatched ones are skipped
+func ParseNotifications(templates []Template, r io.Reader, modTime time.Time) ([]*dto.TransactionDTO, error) {
+	transactions := []*dto.TransactionDTO{}
+	var text []string
+	// occurrences of notification texts without time, repeated ones get different ids
+	occurrences := map[string]int{}
+	flush := func() {
+		if len(text) == 0 {
+			return
+		}
+		t, timed := parseTime(text[0])
+		if timed {
+			text = text[1:]
+		} else {
+			t = modTime
+		}
+		joined := strings.Join(text, " ")
+		text = text[:0]
+		m, err := MatchTemplates(templates, joined)
+		var trans *dto.TransactionDTO
+		if err == nil {
+			trans, err = m.ToTransactionDTO(joined, t)
+		}
+		if err != nil {
+			log.Warn().Err(err).Msgf("Skipping sms notification: %s", joined)
+			return
+		}
+		if !timed {
+			trans.Transaction.ID = transactionID(m.Template.Bank, joined, occurrences[joined])
+			occurrences[joined]++
+		}
+		transactions = append(transactions, trans)
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			flush()
+			continue
+		}
+		text = append(text, line)
+	}
+	flush()
+	return transactions, scanner.Err()
+}
+
+// Match returns the first template matching text
+func (s *SMSConnection) Match(text string) (*Match, error) {
+	s.templatesMu.RLock()
+	defer s.templatesMu.RUnlock()
+	return MatchTemplates(s.templates, text)
+}
+
+// SetTemplates replaces templates with ones from templatesFile (if set) followed by the built-in ones
+func (s *SMSConnection) SetTemplates(templatesFile string) error {
+	templates, err := NewTemplates(templatesFile)
+	if err != nil {
+		return err
+	}
+	s.templatesMu.Lock()
+	defer s.templatesMu.Unlock()
+	s.templates = templates
+	return nil
+}
+
+// MatchTemplates returns the first of templates matching text
+func MatchTemplates(templates []Template, text string) (*Match, error) {
+	text = strings.TrimSpace(text)
+	for i := range templates {
+		if m := templates[i].match(text); m != nil {
+			return m, nil
+		}
+	}
+	return nil, ErrNoTemplateMatched
+}
+
+// ToTransactionDTO parses notification text received at t to transaction
+func (s *SMSConnection) ToTransactionDTO(text string, t time.Time) (*dto.TransactionDTO, error) {
+	m, err := s.Match(text)
+	if err != nil {
+		return nil, err
+	}
+	return m.ToTransactionDTO(text, t)
+}
+
+// ToTransactionDTO converts the match to transaction. Card suffix is used as account id
+func (m *Match) ToTransactionDTO(text string, t time.Time) (*dto.TransactionDTO, error) {
+	amount, err := parseAmount(m.Amount)
+	if err != nil {
+		return nil, err
+	}
+	if m.Direction != directionCredit {
+		amount = -amount
+	}
+	currencyCode, err := parseCurrency(m.Currency)
+	if err != nil {
+		return nil, err
+	}
+	var balance int64
+	if m.Balance != "" {
+		if balance, err = parseAmount(m.Balance); err != nil {
+			return nil, err
+		}
+	}
+	return &dto.TransactionDTO{
+		AccountID: cardSuffix(m.Card),
+		Transaction: dto.TransactionDTOTransaction{
+			ID:           transactionID(m.Template.Bank, t.UTC().Format(time.RFC3339Nano)+" "+text, 0),
+			Amount:       amount,
+			Comment:      text,
+			Time:         t,
+			Description:  strings.TrimSpace(m.Merchant),
+			CurrencyCode: currencyCode,
+			CounterName:  strings.TrimSpace(m.Merchant),
+			Balance:      balance,
+		},
+	}, nil
+}
+
+// transactionID returns id of notification text of bank, seq tells apart the same texts
+func transactionID(bank, text string, seq int) string {
+	if seq != 0 {
+		text += "#" + strconv.Itoa(seq)
+	}
+	sum := sha256.Sum256([]byte(bank + text))
+	return hex.EncodeToString(sum[:16])
+}
+
+// parseTime parses time line of notification in one of timeLayouts, local time is assumed
+func parseTime(line string) (time.Time, bool) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, line, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseAmount converts textual amount to minor units.
+// Both "1 234,56" and "1,234.56" notations are accepted
+func parseAmount(s string) (int64, error) {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '+' || r == '-' {
+			return -1
+		}
+		return r
+	}, s)
+	if s == "" {
+		return 0, fmt.Errorf("%w: %q", ErrBadAmount, s)
+	}
+	integer, fraction := s, ""
+	if i := strings.LastIndexAny(s, ".,"); i != -1 && len(s)-i-1 <= 2 {
+		integer, fraction = s[:i], s[i+1:]
+	}
+	integer = strings.NewReplacer(",", "", ".", "").Replace(integer)
+	for len(fraction) < 2 {
+		fraction += "0"
+	}
+	res, err := strconv.ParseInt(integer+fraction, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrBadAmount, s)
+	}
+	return res, nil
+}
+
+func parseCurrency(s string) (int32, error) {
+	name := strings.ToUpper(strings.TrimSpace(s))
+	if alias, ok := currencyAliases[name]; ok {
+		name = alias
+	}
+	code, _ := iso4217.ByName(name)
+	if code == 0 {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownCurrency, s)
+	}
+	return int32(code), nil
+}
+
+func cardSuffix(card string) string {
+	digits := strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, card)
+	if len(digits) > 4 {
+		return digits[len(digits)-4:]
+	}
+	return digits
+}
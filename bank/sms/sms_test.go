@@ -0,0 +1,208 @@
+package sms
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"150.50", 15050},
+		{"150,50", 15050},
+		{"1 234,56", 123456},
+		{"1 234,56", 123456},
+		{"1,234.56", 123456},
+		{"1.234,56", 123456},
+		{"1,234", 123400},
+		{"12", 1200},
+		{"12.5", 1250},
+		{"-150.50", 15050},
+		{"+1 000.00", 100000},
+	}
+	for _, tt := range tests {
+		got, err := parseAmount(tt.in)
+		if err != nil {
+			t.Errorf("parseAmount(%q): %s", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseAmount(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+	for _, in := range []string{"", "abc", "12.3.4x"} {
+		if _, err := parseAmount(in); !errors.Is(err, ErrBadAmount) {
+			t.Errorf("parseAmount(%q) error = %v, want %v", in, err, ErrBadAmount)
+		}
+	}
+}
+
+const purchase = "Оплата 150,50 грн. Картка *1234. SILPO. Баланс 1 200,00 грн"
+
+func TestTransactionIDs(t *testing.T) {
+	s, err := NewSMSConnection("", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	a, err := s.ToTransactionDTO(purchase, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.AccountID != "1234" || a.Transaction.Amount != -15050 || a.Transaction.Balance != 120000 {
+		t.Errorf("transaction = %+v", a)
+	}
+	b, err := s.ToTransactionDTO(purchase, now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Transaction.ID == b.Transaction.ID {
+		t.Error("the same text received at different times got the same id")
+	}
+	c, _ := s.ToTransactionDTO(purchase, now)
+	if a.Transaction.ID != c.Transaction.ID {
+		t.Error("the same text received at the same time got different ids")
+	}
+}
+
+func importFile(t *testing.T, s *SMSConnection, path string) []*dto.TransactionDTO {
+	s.TransactionChan = make(chan *dto.TransactionDTO, 10)
+	if err := s.ImportFile(path); err != nil {
+		t.Fatal(err)
+	}
+	close(s.TransactionChan)
+	res := []*dto.TransactionDTO{}
+	for trans := range s.TransactionChan {
+		res = append(res, trans)
+	}
+	return res
+}
+
+func TestImportFile(t *testing.T) {
+	s, err := NewSMSConnection("", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "sms.txt")
+	content := "2026-10-12 10:15\n" + purchase + "\n\n" +
+		purchase + "\n\n" +
+		"Unknown notification\n\n" +
+		purchase + "\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got := importFile(t, s, path)
+	if len(got) != 3 {
+		t.Fatalf("got %d transactions, want 3", len(got))
+	}
+	if want := time.Date(2026, 10, 12, 10, 15, 0, 0, time.Local); !got[0].Transaction.Time.Equal(want) {
+		t.Errorf("time = %s, want %s", got[0].Transaction.Time, want)
+	}
+	if got[0].Transaction.Comment != purchase {
+		t.Errorf("comment = %q, want %q", got[0].Transaction.Comment, purchase)
+	}
+	ids := map[string]bool{}
+	for _, v := range got {
+		ids[v.Transaction.ID] = true
+	}
+	if len(ids) != 3 {
+		t.Errorf("got %d distinct ids, want 3", len(ids))
+	}
+
+	// Ids are kept when the file is appended
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("\n" + purchase + "\n")
+	f.Close()
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Hour))
+	again := importFile(t, s, path)
+	if len(again) != 4 {
+		t.Fatalf("got %d transactions after append, want 4", len(again))
+	}
+	for i := range got {
+		if again[i].Transaction.ID != got[i].Transaction.ID {
+			t.Errorf("transaction %d id changed after append", i)
+		}
+	}
+	if ids[again[3].Transaction.ID] {
+		t.Error("appended transaction got id of another one")
+	}
+}
+
+func TestWebhookSecret(t *testing.T) {
+	s, err := NewSMSConnection("", "/sms", "secret", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path   string
+		header string
+		want   int
+	}{
+		{"/sms", "secret", http.StatusOK},
+		{"/sms/secret", "", http.StatusOK},
+		{"/sms", "", http.StatusNotFound},
+		{"/sms/", "", http.StatusNotFound},
+		{"/sms/wrong", "", http.StatusNotFound},
+		{"/sms", "wrong", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		s.TransactionChan = make(chan *dto.TransactionDTO, 1)
+		r := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(purchase))
+		if tt.header != "" {
+			r.Header.Set("X-FBS-Secret", tt.header)
+		}
+		w := httptest.NewRecorder()
+		s.processNotificationPost(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s with header %q: status %d, want %d", tt.path, tt.header, w.Code, tt.want)
+		}
+		if got := len(s.TransactionChan); (got == 1) != (tt.want == http.StatusOK) {
+			t.Errorf("%s with header %q: %d transactions queued", tt.path, tt.header, got)
+		}
+	}
+}
+
+func TestWebhookTime(t *testing.T) {
+	s, err := NewSMSConnection("", "/sms", "secret", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := func(body string) *dto.TransactionDTO {
+		s.TransactionChan = make(chan *dto.TransactionDTO, 1)
+		r := httptest.NewRequest(http.MethodPost, "/sms/secret", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		s.processNotificationPost(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		return <-s.TransactionChan
+	}
+
+	timed := "2026-10-19T08:30:00+03:00\n" + purchase
+	first, retry := post(timed), post(timed)
+	if first.Transaction.ID != retry.Transaction.ID {
+		t.Error("retry of timed notification got another id")
+	}
+	if want := time.Date(2026, 10, 19, 5, 30, 0, 0, time.UTC); !first.Transaction.Time.Equal(want) {
+		t.Errorf("time = %s, want %s", first.Transaction.Time, want)
+	}
+	if first.Transaction.Comment != purchase {
+		t.Errorf("comment = %q, want notification text without time", first.Transaction.Comment)
+	}
+	if other := post("2026-10-19T08:31:00+03:00\n" + purchase); other.Transaction.ID == first.Transaction.ID {
+		t.Error("notification sent at another time got the same id")
+	}
+}
@@ -0,0 +1,48 @@
+package sms
+
+import "time"
+
+// timeLayouts - formats of time line preceding notification text in file
+var timeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04"}
+
+// builtinTemplates is a library of commonly met notification formats.
+// Templates from SMS_TEMPLATES_FILE are matched before these
+var builtinTemplates = []Template{
+	{
+		// -150.50UAH Kartka 5*34 Silpo. Bal 1 200.00UAH
+		Name:        "privatbank-card",
+		Bank:        "privatbank",
+		Pattern:     `^(?P<direction>[+-])?(?P<amount>[\d ]+[.,]\d{2}) ?(?P<currency>[A-Z]{3}) (?:Kartka|Картка) (?P<card>\d\*\d{2,4}) (?P<merchant>.+?)\.? (?:Bal|Бал)\.? (?P<balance>[\d ]+[.,]\d{2}) ?[A-Z]{3}`,
+		CreditWords: []string{"+"},
+	},
+	{
+		// Оплата 150,50 грн. Картка *1234. SILPO. Баланс 1 200,00 грн
+		Name:      "ua-generic-purchase",
+		Bank:      "generic",
+		Pattern:   `(?i)(?:Оплата|Покупка|Списання) (?P<amount>[\d  ]+[.,]\d{2}) ?(?P<currency>грн|uah|usd|eur|\$|€)\.?,? (?:Картка|Карта|Рахунок) \*?(?P<card>\d{4})\.?,? (?P<merchant>.+?)\.? Баланс:? (?P<balance>[\d  ]+[.,]\d{2})`,
+		Direction: directionDebit,
+	},
+	{
+		// Зарахування 1 000,00 грн. Картка *1234. Баланс 2 200,00 грн
+		Name:      "ua-generic-income",
+		Bank:      "generic",
+		Pattern:   `(?i)(?:Зарахування|Поповнення) (?P<amount>[\d  ]+[.,]\d{2}) ?(?P<currency>грн|uah|usd|eur|\$|€)\.?,? (?:Картка|Карта|Рахунок) \*?(?P<card>\d{4})\.?,?(?: (?P<merchant>.+?)\.?)? Баланс:? (?P<balance>[\d  ]+[.,]\d{2})`,
+		Direction: directionCredit,
+	},
+	{
+		// Card *1234: purchase 12.50 USD at AMAZON. Balance: 100.00 USD
+		Name:        "en-generic-card",
+		Bank:        "generic",
+		Pattern:     `(?i)card \*?(?P<card>\d{4}):? (?P<direction>purchase|payment|withdrawal|refund|deposit|credit) (?:of )?(?P<amount>[\d,]+(?:\.\d{2})?) ?(?P<currency>[A-Z]{3}|\$|€)(?: (?:at|from) (?P<merchant>[^.]+))?\.?(?: (?:Balance|Avail(?:able)?(?: balance)?):? (?P<balance>[\d,]+(?:\.\d{2})?))?`,
+		CreditWords: []string{"refund", "deposit", "credit"},
+	},
+}
+
+// currencyAliases maps non ISO currency notations to ISO 4217 names
+var currencyAliases = map[string]string{
+	"ГРН": "UAH",
+	"$":   "USD",
+	"€":   "EUR",
+	"£":   "GBP",
+	"ZŁ":  "PLN",
+}
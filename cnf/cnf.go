@@ -1,22 +1,188 @@
 package cnf
 
-import "github.com/caarlos0/env"
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
 
-// Cnf the config object with configuration parameters
+	"github.com/caarlos0/env"
+)
+
+// Cnf the config object with configuration parameters. Parameters are read from
+// env variables defined in env tags and from config file keys defined in key tags
 type Cnf struct {
-	MonobankAPIToken string `env:"MONOBANK_API_TOKEN,required"`
-	FBSHost          string `env:"FBS_HOST,required"`
-	LogLevel         string `env:"LOG_LEVEL" envDefault:"debug"`
-	ListenAddr       string `env:"LISTEN_ADDRESS" envDefault:":3000"`
-	FFIToken         string `env:"FFI_TOKEN,required"`
-	FFIURL           string `env:"FFI_URL,required"`
+	MonobankAPIToken string `env:"MONOBANK_API_TOKEN" key:"monobank.token" required:"true"`
+	FBSHost          string `env:"FBS_HOST" key:"host"`
+	LogLevel         string `env:"LOG_LEVEL" key:"log_level" envDefault:"debug"`
+	ListenAddr       string `env:"LISTEN_ADDRESS" key:"listen_address" envDefault:":3000"`
+	// HealthListenAddr - health endpoints are served on their own listener instead of ListenAddr when set
+	HealthListenAddr string `env:"HEALTH_LISTEN_ADDRESS" key:"health.listen_address"`
+	FFIToken         string `env:"FFI_TOKEN" key:"firefly.token" required:"true"`
+	FFIURL           string `env:"FFI_URL" key:"firefly.url" required:"true"`
+	StateFile        string `env:"STATE_FILE" key:"state_file" envDefault:"fbs-state.json"`
+
+	// ShutdownTimeout - time transactions being created are waited for on shutdown.
+	// Unfinished ones are created on the next start
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" key:"shutdown_timeout" envDefault:"30s"`
+
+	// FFIWorkers - number of transactions created in firefly-iii in parallel
+	FFIWorkers int `env:"FFI_WORKERS" key:"firefly.workers" envDefault:"4"`
+	// FFIQueueSize - number of transactions waiting for workers, journal dispatch waits when it is full
+	FFIQueueSize int `env:"FFI_QUEUE_SIZE" key:"firefly.queue_size" envDefault:"1000"`
+	// FFIDryRun - firefly-iii payloads are logged and stored in journal instead of being sent
+	FFIDryRun bool `env:"FFI_DRY_RUN" key:"firefly.dry_run"`
+	// FFIAccounts - bank accounts mapped to firefly-iii accounts in addition to fbs notes.
+	// Config file only
+	FFIAccounts []AccountMapping `key:"firefly.accounts"`
+	// FFIBudgets - budgets assigned to withdrawals by category or MCC when rules set none.
+	// Config file only
+	FFIBudgets []BudgetMapping `key:"firefly.budgets"`
+	// FFIBills - withdrawals are linked to active firefly-iii bills they match
+	FFIBills bool `env:"FFI_BILLS" key:"firefly.bills.enabled" envDefault:"true"`
+	// FFIBillsCheckInterval - how often bills expected and not paid are reported, 0 disables
+	FFIBillsCheckInterval time.Duration `env:"FFI_BILLS_CHECK_INTERVAL" key:"firefly.bills.check_interval" envDefault:"24h"`
+	// FFIBillsGrace - time after (and before) expected date payment of bill is waited for
+	FFIBillsGrace time.Duration `env:"FFI_BILLS_GRACE" key:"firefly.bills.grace" envDefault:"72h"`
+
+	// AdminToken - bearer token of admin api, the api is disabled when both tokens are empty
+	AdminToken string `env:"ADMIN_TOKEN" key:"admin.token"`
+	// AdminViewerToken - bearer token of admin api allowing read requests only
+	AdminViewerToken string `env:"ADMIN_VIEWER_TOKEN" key:"admin.viewer_token"`
+	// JournalSize - number of recent transactions kept in journal
+	JournalSize int `env:"JOURNAL_SIZE" key:"admin.journal_size" envDefault:"1000"`
+
+	// TracingExporter - stdout or otlp, tracing is disabled when empty. OTLP exporter
+	// is configured with standard OTEL_EXPORTER_OTLP_* variables
+	TracingExporter string `env:"TRACING_EXPORTER" key:"tracing.exporter"`
+
+	// RulesFile - json file with rules applied to transactions before they are created
+	RulesFile string `env:"RULES_FILE" key:"rules_file"`
+
+	// PayeeAccounts - counterparty expense and revenue accounts are named by normalized payee
+	PayeeAccounts bool `env:"PAYEE_ACCOUNTS" key:"payee.accounts" envDefault:"true"`
+	// PayeeAliasesFile - json file with aliases giving one name to spellings of a payee
+	PayeeAliasesFile string `env:"PAYEE_ALIASES_FILE" key:"payee.aliases_file"`
+	// PayeeStableKeys - counterparty edrpou or iban keeps the first name found for it
+	PayeeStableKeys bool `env:"PAYEE_STABLE_KEYS" key:"payee.stable_keys"`
+
+	MonoAPIURL                 string        `env:"MONO_API_URL" key:"monobank.api_url" envDefault:"https://api.monobank.ua"`
+	MonoMode                   string        `env:"MONO_MODE" key:"monobank.mode" envDefault:"webhook"`
+	MonoPollInterval           time.Duration `env:"MONO_POLL_INTERVAL" key:"monobank.poll_interval" envDefault:"5m"`
+	MonoPollAccounts           []string      `env:"MONO_POLL_ACCOUNTS" key:"monobank.poll_accounts"`
+	MonoJarsSyncInterval       time.Duration `env:"MONO_JARS_SYNC_INTERVAL" key:"monobank.jars_sync_interval" envDefault:"1h"`
+	MonoRatesSyncInterval      time.Duration `env:"MONO_RATES_SYNC_INTERVAL" key:"monobank.rates_sync_interval" envDefault:"0"`
+	MonoRatesCurrencies        []string      `env:"MONO_RATES_CURRENCIES" key:"monobank.rates_currencies" envDefault:"USD,EUR"`
+	MonoWebhookPath            string        `env:"MONO_WEBHOOK_PATH" key:"monobank.webhook.path"`
+	MonoWatchdogInterval       time.Duration `env:"MONO_WATCHDOG_INTERVAL" key:"monobank.webhook.watchdog_interval" envDefault:"10m"`
+	MonoWebhookAllowedIPs      []string      `env:"MONO_WEBHOOK_ALLOWED_IPS" key:"monobank.webhook.allowed_ips"`
+	MonoWebhookRealIPHeader    string        `env:"MONO_WEBHOOK_REAL_IP_HEADER" key:"monobank.webhook.real_ip_header"`
+	MonoWebhookSecret          string        `env:"MONO_WEBHOOK_SECRET" key:"monobank.webhook.secret"`
+	MonoWebhookVerifyStatement bool          `env:"MONO_WEBHOOK_VERIFY_STATEMENT" key:"monobank.webhook.verify_statement"`
+
+	SMSTemplatesFile string `env:"SMS_TEMPLATES_FILE" key:"sms.templates_file"`
+	SMSWebhookPath   string `env:"SMS_WEBHOOK_PATH" key:"sms.webhook_path"`
+	SMSWebhookSecret string `env:"SMS_WEBHOOK_SECRET" key:"sms.webhook_secret"`
+	SMSFile          string `env:"SMS_FILE" key:"sms.file"`
+
+	IMAPAddress       string        `env:"IMAP_ADDRESS" key:"imap.address"`
+	IMAPUsername      string        `env:"IMAP_USERNAME" key:"imap.username"`
+	IMAPPassword      string        `env:"IMAP_PASSWORD" key:"imap.password"`
+	IMAPFolder        string        `env:"IMAP_FOLDER" key:"imap.folder" envDefault:"INBOX"`
+	IMAPTLS           bool          `env:"IMAP_TLS" key:"imap.tls" envDefault:"true"`
+	IMAPPollInterval  time.Duration `env:"IMAP_POLL_INTERVAL" key:"imap.poll_interval" envDefault:"5m"`
+	IMAPParsersFile   string        `env:"IMAP_PARSERS_FILE" key:"imap.parsers_file"`
+	IMAPProcessedFlag string        `env:"IMAP_PROCESSED_FLAG" key:"imap.processed_flag" envDefault:"$FBSProcessed"`
+}
+
+// AccountMapping maps bank account to firefly-iii account
+type AccountMapping struct {
+	// Source - source name used in fbs notes, e.g. mono
+	Source    string `json:"source"`
+	AccountID string `json:"account"`
+	FireflyID string `json:"firefly_id"`
+}
+
+// BudgetMapping assigns firefly-iii budget to withdrawals of categories or MCC codes
+type BudgetMapping struct {
+	Budget     string   `json:"budget"`
+	Categories []string `json:"categories"`
+	// MCC - codes or ranges of codes, e.g. "5811-5814"
+	MCC []string `json:"mcc"`
 }
 
-// Parse parses the env variables defined in Cnf tags to Cnf struct pointer
+// Parse parses configuration. Env variables override config file set in CONFIG_FILE,
+// which overrides defaults. Value of every variable can be read from file set in
+// the variable with _FILE suffix, e.g. FFI_TOKEN_FILE=/run/secrets/ffi_token
 func Parse() (*Cnf, error) {
+	cnf, err := ParsePartial()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRequired(cnf); err != nil {
+		return nil, err
+	}
+	return cnf, nil
+}
+
+// ParsePartial parses configuration like Parse without checking required parameters.
+// It is used by commands connecting neither to bank nor to firefly-iii
+func ParsePartial() (*Cnf, error) {
 	cnf := Cnf{}
 	if err := env.Parse(&cnf); err != nil {
 		return nil, err
 	}
+	if err := applySecretFiles(&cnf); err != nil {
+		return nil, err
+	}
+	if path := os.Getenv(configFileEnv); path != "" {
+		if err := loadFile(&cnf, path); err != nil {
+			return nil, err
+		}
+	}
 	return &cnf, nil
 }
+
+// Name returns name of parameter set by env variable for error messages,
+// e.g. "MONO_MODE (monobank.mode)"
+func Name(envName string) string {
+	for _, f := range fields {
+		if f.env == envName && f.key != "" {
+			return fmt.Sprintf("%s (%s)", envName, f.key)
+		}
+	}
+	return envName
+}
+
+// Changed returns env variables (or config keys of parameters without one) which
+// values differ in a and b
+func Changed(a, b *Cnf) []string {
+	names := []string{}
+	for _, f := range fields {
+		if reflect.DeepEqual(a.field(f).Interface(), b.field(f).Interface()) {
+			continue
+		}
+		if f.env != "" {
+			names = append(names, f.env)
+		} else {
+			names = append(names, f.key)
+		}
+	}
+	return names
+}
+
+// File returns path of config file, empty if not set
+func File() string {
+	return os.Getenv(configFileEnv)
+}
+
+func checkRequired(cnf *Cnf) error {
+	errs := []error{}
+	for _, f := range fields {
+		if f.required && cnf.field(f).IsZero() {
+			errs = append(errs, fmt.Errorf("%s is required", Name(f.env)))
+		}
+	}
+	return errors.Join(errs...)
+}
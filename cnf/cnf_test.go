@@ -0,0 +1,159 @@
+package cnf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, data string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const testYAML = `
+monobank:
+  token: mono-token
+  poll_interval: 1m
+  poll_accounts: [a1, a2]
+firefly:
+  url: http://firefly
+  token_file: %s
+  workers: 2
+  dry_run: true
+  accounts:
+    - source: mono
+      account: a1
+      firefly_id: "5"
+log_level: info
+`
+
+const testTOML = `
+log_level = "info"
+
+[monobank]
+token = "mono-token"
+poll_interval = "1m"
+poll_accounts = ["a1", "a2"]
+
+[firefly]
+url = "http://firefly"
+token_file = "%s"
+workers = 2
+dry_run = true
+
+[[firefly.accounts]]
+source = "mono"
+account = "a1"
+firefly_id = "5"
+`
+
+func TestParseFile(t *testing.T) {
+	secret := writeFile(t, "ffi_token", "ffi-token\n")
+	for name, data := range map[string]string{"config.yaml": testYAML, "config.toml": testTOML} {
+		t.Setenv(configFileEnv, writeFile(t, name, strings.Replace(data, "%s", secret, 1)))
+		cnf, err := Parse()
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if cnf.MonobankAPIToken != "mono-token" || cnf.FFIToken != "ffi-token" || cnf.FFIURL != "http://firefly" ||
+			cnf.LogLevel != "info" || cnf.FFIWorkers != 2 || !cnf.FFIDryRun || cnf.MonoPollInterval != time.Minute {
+			t.Errorf("%s: config = %+v", name, cnf)
+		}
+		if !reflect.DeepEqual(cnf.MonoPollAccounts, []string{"a1", "a2"}) {
+			t.Errorf("%s: poll accounts = %v", name, cnf.MonoPollAccounts)
+		}
+		if !reflect.DeepEqual(cnf.FFIAccounts, []AccountMapping{{Source: "mono", AccountID: "a1", FireflyID: "5"}}) {
+			t.Errorf("%s: accounts = %+v", name, cnf.FFIAccounts)
+		}
+		// Defaults are kept for keys not in the file
+		if cnf.ListenAddr != ":3000" || cnf.FFIQueueSize != 1000 {
+			t.Errorf("%s: defaults = %q, %d", name, cnf.ListenAddr, cnf.FFIQueueSize)
+		}
+	}
+}
+
+func TestEnvOverridesFile(t *testing.T) {
+	t.Setenv(configFileEnv, writeFile(t, "config.yml", "log_level: info\nfirefly:\n  workers: 2\n  token: file-token\n"))
+	t.Setenv("LOG_LEVEL", "warn")
+	t.Setenv("FFI_TOKEN_FILE", writeFile(t, "ffi_token", "secret-token\r\n"))
+	cnf, err := ParsePartial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cnf.LogLevel != "warn" || cnf.FFIToken != "secret-token" || cnf.FFIWorkers != 2 {
+		t.Errorf("config = %q, %q, %d", cnf.LogLevel, cnf.FFIToken, cnf.FFIWorkers)
+	}
+
+	// Env variable takes precedence over its _FILE variant
+	t.Setenv("FFI_TOKEN", "env-token")
+	if cnf, err = ParsePartial(); err != nil || cnf.FFIToken != "env-token" {
+		t.Errorf("token = %q, %v", cnf.FFIToken, err)
+	}
+}
+
+func TestFileErrors(t *testing.T) {
+	t.Setenv(configFileEnv, writeFile(t, "config.json", "{}"))
+	if _, err := ParsePartial(); !errors.Is(err, ErrConfigFormat) {
+		t.Errorf("error = %v, want %v", err, ErrConfigFormat)
+	}
+
+	t.Setenv(configFileEnv, writeFile(t, "config.yaml", `
+log_levl: info
+firefly:
+  workers: many
+  dry_run: maybe
+  accounts:
+    - source: mono
+      unknown: 1
+monobank:
+  token: [a, b]
+`))
+	_, err := ParsePartial()
+	for _, want := range []error{ErrUnknownKey, ErrInvalidValue, ErrNotList} {
+		if !errors.Is(err, want) {
+			t.Errorf("error = %v, want %v", err, want)
+		}
+	}
+	// Every problem is reported with its line
+	for _, want := range []string{":2: log_levl", ":4: firefly.workers", ":5: firefly.dry_run", ":6: firefly.accounts", ":10: monobank.token"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error %v does not report %q", err, want)
+		}
+	}
+
+	t.Setenv(configFileEnv, writeFile(t, "config.yaml", "- a\n- b\n"))
+	if _, err := ParsePartial(); !errors.Is(err, ErrNotMapping) {
+		t.Errorf("error = %v, want %v", err, ErrNotMapping)
+	}
+}
+
+func TestRequired(t *testing.T) {
+	t.Setenv(configFileEnv, writeFile(t, "config.yaml", "monobank:\n  token: mono-token\n"))
+	t.Setenv("FFI_URL", "http://firefly")
+	_, err := Parse()
+	if err == nil || !strings.Contains(err.Error(), "FFI_TOKEN (firefly.token) is required") {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestChanged(t *testing.T) {
+	a := &Cnf{LogLevel: "info", FFIWorkers: 2}
+	b := &Cnf{LogLevel: "info", FFIWorkers: 4, FFIAccounts: []AccountMapping{{Source: "mono"}}}
+	if got := Changed(a, b); !reflect.DeepEqual(got, []string{"FFI_WORKERS", "firefly.accounts"}) {
+		t.Errorf("Changed = %v", got)
+	}
+	if got := Changed(a, a); len(got) != 0 {
+		t.Errorf("Changed = %v, want none", got)
+	}
+	if got := Name("MONO_MODE"); got != "MONO_MODE (monobank.mode)" {
+		t.Errorf("Name = %q", got)
+	}
+}
@@ -0,0 +1,12 @@
+package cnf
+
+import "errors"
+
+var (
+	ErrConfigFormat = errors.New("Config file format is unrecognized. Eligible formats are: yaml, toml")
+	ErrUnknownKey   = errors.New("Unknown key")
+	ErrInvalidValue = errors.New("Invalid value")
+	ErrNotScalar    = errors.New("Value must be a single value")
+	ErrNotList      = errors.New("Value must not be a list")
+	ErrNotMapping   = errors.New("Config file must be a mapping of keys")
+)
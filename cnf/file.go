@@ -0,0 +1,296 @@
+package cnf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// field describes Cnf field by its tags
+type field struct {
+	index    int
+	env      string
+	key      string
+	required bool
+	// structured - field is a list of objects, set from config file only
+	structured bool
+}
+
+// fields of Cnf settable by env variables or config file
+var fields = func() []field {
+	list := []field{}
+	t := reflect.TypeOf(Cnf{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		list = append(list, field{
+			index:      i,
+			env:        f.Tag.Get("env"),
+			key:        f.Tag.Get("key"),
+			required:   f.Tag.Get("required") == "true",
+			structured: f.Type.Kind() == reflect.Slice && f.Type.Elem().Kind() == reflect.Struct,
+		})
+	}
+	return list
+}()
+
+func (c *Cnf) field(f field) reflect.Value {
+	return reflect.ValueOf(c).Elem().Field(f.index)
+}
+
+// entry is a value of config file key. Value is string, []string or
+// decoded object for structured fields
+type entry struct {
+	key   string
+	value interface{}
+	// pos - position of the key for error messages
+	pos string
+}
+
+// applySecretFiles sets fields from files set in env variables with _FILE suffix.
+// Env variable without the suffix takes precedence
+func applySecretFiles(cnf *Cnf) error {
+	errs := []error{}
+	for _, f := range fields {
+		path := os.Getenv(f.env + secretFileEnvSuffix)
+		if f.env == "" || path == "" || os.Getenv(f.env) != "" {
+			continue
+		}
+		if err := setSecretFile(cnf.field(f), path); err != nil {
+			errs = append(errs, fmt.Errorf("%s%s: %w", f.env, secretFileEnvSuffix, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// loadFile sets fields from yaml or toml config file. Fields set by env variables
+// are not changed. All the unknown keys and invalid values are reported
+func loadFile(cnf *Cnf, path string) error {
+	var entries []entry
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		entries, err = readYAML(path)
+	case ".toml":
+		entries, err = readTOML(path)
+	default:
+		return fmt.Errorf("%s: %w", path, ErrConfigFormat)
+	}
+	if err != nil {
+		return err
+	}
+
+	byKey := map[string]field{}
+	for _, f := range fields {
+		if f.key != "" {
+			byKey[f.key] = f
+		}
+	}
+	errs := []error{}
+	for _, e := range entries {
+		secret := false
+		f, ok := byKey[e.key]
+		if !ok && strings.HasSuffix(e.key, secretFileKeySuffix) {
+			f, ok = byKey[strings.TrimSuffix(e.key, secretFileKeySuffix)]
+			secret = ok && !f.structured
+		}
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %w", e.pos, ErrUnknownKey))
+			continue
+		}
+		if f.env != "" && (os.Getenv(f.env) != "" || os.Getenv(f.env+secretFileEnvSuffix) != "") {
+			continue
+		}
+		if err := setEntry(cnf.field(f), e, f.structured, secret); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", e.pos, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func setEntry(v reflect.Value, e entry, structured, secret bool) error {
+	if structured {
+		// Objects are decoded with json tags of the field type
+		data, err := json.Marshal(e.value)
+		if err != nil {
+			return err
+		}
+		dec := json.NewDecoder(strings.NewReader(string(data)))
+		dec.DisallowUnknownFields()
+		ptr := reflect.New(v.Type())
+		if err := dec.Decode(ptr.Interface()); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidValue, strings.TrimPrefix(err.Error(), "json: "))
+		}
+		v.Set(ptr.Elem())
+		return nil
+	}
+	switch value := e.value.(type) {
+	case string:
+		if secret {
+			return setSecretFile(v, value)
+		}
+		return setString(v, value)
+	case []string:
+		if v.Kind() != reflect.Slice || secret {
+			return ErrNotList
+		}
+		v.Set(reflect.ValueOf(value))
+		return nil
+	default:
+		return ErrNotScalar
+	}
+}
+
+// setSecretFile sets field from file content without trailing newline
+func setSecretFile(v reflect.Value, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return setString(v, strings.TrimRight(string(data), "\r\n"))
+}
+
+// setString parses s according to field type the way env variables are parsed
+func setString(v reflect.Value, s string) error {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidValue, err)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("%w: %q is not a boolean", ErrInvalidValue, s)
+		}
+		v.SetBool(b)
+	case reflect.Int:
+		i, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("%w: %q is not an integer", ErrInvalidValue, s)
+		}
+		v.SetInt(int64(i))
+	case reflect.Slice:
+		list := []string{}
+		for _, item := range strings.Split(s, ",") {
+			list = append(list, strings.TrimSpace(item))
+		}
+		v.Set(reflect.ValueOf(list))
+	default:
+		return ErrNotScalar
+	}
+	return nil
+}
+
+// readYAML returns entries of yaml file with their line numbers
+func readYAML(path string) ([]entry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc := yaml.Node{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	entries := []entry{}
+	errs := []error{}
+	var walk func(prefix string, n *yaml.Node)
+	walk = func(prefix string, n *yaml.Node) {
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			key := prefix + k.Value
+			pos := fmt.Sprintf("%s:%d: %s", path, k.Line, key)
+			switch {
+			case isStructured(key):
+				var value interface{}
+				if err := v.Decode(&value); err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", pos, err))
+					continue
+				}
+				entries = append(entries, entry{key: key, value: value, pos: pos})
+			case v.Kind == yaml.MappingNode:
+				walk(key+".", v)
+			case v.Kind == yaml.SequenceNode:
+				list := []string{}
+				for _, item := range v.Content {
+					if item.Kind != yaml.ScalarNode {
+						errs = append(errs, fmt.Errorf("%s:%d: %s: %w", path, item.Line, key, ErrNotScalar))
+						continue
+					}
+					list = append(list, item.Value)
+				}
+				entries = append(entries, entry{key: key, value: list, pos: pos})
+			default:
+				entries = append(entries, entry{key: key, value: v.Value, pos: pos})
+			}
+		}
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: %w", path, ErrNotMapping)
+	}
+	walk("", doc.Content[0])
+	return entries, errors.Join(errs...)
+}
+
+// readTOML returns entries of toml file
+func readTOML(path string) ([]entry, error) {
+	doc := map[string]interface{}{}
+	if _, err := toml.DecodeFile(path, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	entries := []entry{}
+	var walk func(prefix string, m map[string]interface{})
+	walk = func(prefix string, m map[string]interface{}) {
+		for k, v := range m {
+			key := prefix + k
+			pos := path + ": " + key
+			if isStructured(key) {
+				entries = append(entries, entry{key: key, value: v, pos: pos})
+				continue
+			}
+			switch value := v.(type) {
+			case map[string]interface{}:
+				walk(key+".", value)
+			case []interface{}:
+				list := []string{}
+				for _, item := range value {
+					list = append(list, fmt.Sprint(item))
+				}
+				entries = append(entries, entry{key: key, value: list, pos: pos})
+			case []map[string]interface{}:
+				entries = append(entries, entry{key: key, value: value, pos: pos})
+			default:
+				entries = append(entries, entry{key: key, value: fmt.Sprint(value), pos: pos})
+			}
+		}
+	}
+	walk("", doc)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+	return entries, nil
+}
+
+func isStructured(key string) bool {
+	for _, f := range fields {
+		if f.key == key {
+			return f.structured
+		}
+	}
+	return false
+}
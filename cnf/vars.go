@@ -0,0 +1,10 @@
+package cnf
+
+// configFileEnv - env variable with path to yaml or toml config file
+const configFileEnv = "CONFIG_FILE"
+
+// secretFileSuffix - suffix of env variables and config keys with path to file the value is read from
+const (
+	secretFileEnvSuffix = "_FILE"
+	secretFileKeySuffix = "_file"
+)
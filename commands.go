@@ -0,0 +1,533 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rmg/iso4217"
+	"github.com/rs/zerolog/log"
+	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+	"github.com/sudores/firefly-iii-bank-sync/bank/mono"
+	"github.com/sudores/firefly-iii-bank-sync/bank/sms"
+	"github.com/sudores/firefly-iii-bank-sync/cnf"
+	firelfyiii "github.com/sudores/firefly-iii-bank-sync/dest/fireflyiii"
+	"github.com/sudores/firefly-iii-bank-sync/journal"
+	"github.com/sudores/firefly-iii-bank-sync/payee"
+	"github.com/sudores/firefly-iii-bank-sync/rules"
+	"github.com/sudores/firefly-iii-bank-sync/store"
+)
+
+var errUsage = errors.New("Invalid command usage")
+
+// commandEnv is configuration and state shared by one-shot commands
+type commandEnv struct {
+	cfg *cnf.Cnf
+	st  *store.Store
+	ctx context.Context
+}
+
+// newCommandEnv loads configuration logging to stderr, so command output is not mixed with logs.
+// Context is cancelled on interrupt
+func newCommandEnv() (*commandEnv, context.CancelFunc, error) {
+	cfg, err := loadConfig(os.Stderr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := validateConfig(cfg); err != nil {
+		return nil, nil, err
+	}
+	st, err := store.Open(cfg.StateFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to open state file: %w", err)
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	return &commandEnv{cfg: cfg, st: st, ctx: ctx}, cancel, nil
+}
+
+// run creates transactions produce sends to src applying rules. Produce must not close src.
+// In dry run firefly-iii payloads are printed instead and journal is not changed
+func (e *commandEnv) run(source string, dryRun bool, src chan *dto.TransactionDTO, produce func() error) error {
+	jr, err := journal.New(e.st, e.cfg.JournalSize)
+	if err != nil {
+		return err
+	}
+	rulesEngine, err := newRulesEngine(e.cfg)
+	if err != nil {
+		return err
+	}
+	payees, err := newPayeeNormalizer(e.cfg, e.st)
+	if err != nil {
+		return err
+	}
+	if payees != nil && dryRun {
+		payees.SetReadOnly()
+	}
+	var recorder firelfyiii.Recorder = jr
+	if dryRun {
+		recorder = nopRecorder{}
+	}
+	ffi := newFireflyiiiConnection(e.cfg, recorder)
+	if dryRun {
+		ffi.SetDryRun(true, os.Stdout)
+	}
+
+	var produceErr error
+	go func() {
+		produceErr = produce()
+		close(src)
+	}()
+
+	var created, duplicates, failed int
+	for trans := range src {
+		if res := rulesEngine.Apply(source, trans); res.Drop {
+			log.Info().Msgf("Transaction %s is dropped by rule %q", trans.Transaction.ID, res.Rules[len(res.Rules)-1])
+			continue
+		}
+		if payees != nil {
+			payees.Apply(trans)
+		}
+		if !dryRun {
+			// Journal persistence failure is logged, the transaction is created anyway
+			if received, _ := jr.Received(source, trans); !received {
+				log.Info().Msgf("Transaction %s is skipped or already created", trans.Transaction.ID)
+				continue
+			}
+		}
+		err := ffi.Create(e.ctx, trans)
+		switch {
+		case errors.Is(err, firelfyiii.ErrDuplicate):
+			duplicates++
+		case err != nil:
+			failed++
+			log.Warn().Err(err).Msgf("Failed to create transaction with id: %s", trans.Transaction.ID)
+		default:
+			created++
+		}
+	}
+	if err := jr.Flush(); err != nil {
+		return err
+	}
+	if payees != nil {
+		if err := payees.Flush(); err != nil {
+			return err
+		}
+	}
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "Rendered: %d, failed: %d\n", created, failed)
+	} else {
+		fmt.Printf("Created: %d, duplicates: %d, failed: %d\n", created, duplicates, failed)
+	}
+	if produceErr == nil && failed != 0 {
+		return fmt.Errorf("%d transactions failed", failed)
+	}
+	return produceErr
+}
+
+// backfillCommand creates monobank transactions of account in the date range
+func backfillCommand(dryRun bool) command {
+	return func(args []string) error {
+		fs := flag.NewFlagSet("backfill", flag.ContinueOnError)
+		account := fs.String("account", "", "monobank account or jar id")
+		from := fs.String("from", "", "start date, 2006-01-02 or RFC3339")
+		to := fs.String("to", "", "end date, now by default")
+		if err := fs.Parse(args); err != nil {
+			return errUsage
+		}
+		if *account == "" || *from == "" {
+			return fmt.Errorf("%w: -account and -from are required", errUsage)
+		}
+		fromTime, err := parseTime(*from)
+		if err != nil {
+			return err
+		}
+		toTime := time.Now()
+		if *to != "" {
+			if toTime, err = parseTime(*to); err != nil {
+				return err
+			}
+		}
+
+		e, cancel, err := newCommandEnv()
+		if err != nil {
+			return err
+		}
+		defer cancel()
+		mb, err := newMonoConnection(e.cfg, e.st, mono.NewClient(e.cfg.MonoAPIURL, e.cfg.MonobankAPIToken))
+		if err != nil {
+			return err
+		}
+		// Jars and account currencies are known to served connection only
+		if err := mb.RefreshAccounts(e.ctx); err != nil {
+			return fmt.Errorf("Failed to get monobank accounts: %w", err)
+		}
+		return e.run("monobank", dryRun, mb.TransactionChan, func() error {
+			defer mb.FlushHeld()
+			return mb.Backfill(e.ctx, *account, fromTime, toTime)
+		})
+	}
+}
+
+// importCommand creates transactions from sms notifications or json file
+func importCommand(dryRun bool) command {
+	return func(args []string) error {
+		fs := flag.NewFlagSet("import", flag.ContinueOnError)
+		format := fs.String("format", "sms", "file format: sms - notifications separated by empty lines, json - array of transactions")
+		if err := fs.Parse(args); err != nil {
+			return errUsage
+		}
+		if fs.NArg() != 1 {
+			return fmt.Errorf("%w: file is required", errUsage)
+		}
+		path := fs.Arg(0)
+
+		e, cancel, err := newCommandEnv()
+		if err != nil {
+			return err
+		}
+		defer cancel()
+		switch *format {
+		case "sms":
+			smsConn, err := sms.NewSMSConnection(e.cfg.SMSTemplatesFile, "", "", "")
+			if err != nil {
+				return err
+			}
+			return e.run("sms", dryRun, smsConn.TransactionChan, func() error {
+				return smsConn.ImportFile(path)
+			})
+		case "json":
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			transactions := []*dto.TransactionDTO{}
+			if err := json.Unmarshal(data, &transactions); err != nil {
+				return err
+			}
+			src := make(chan *dto.TransactionDTO)
+			return e.run("import", dryRun, src, func() error {
+				for _, trans := range transactions {
+					src <- trans
+				}
+				return nil
+			})
+		default:
+			return fmt.Errorf("%w: format %q is unrecognized", errUsage, *format)
+		}
+	}
+}
+
+// accountsCommand lists monobank accounts and jars with firefly-iii accounts they are synced to
+func accountsCommand(args []string) error {
+	if len(args) != 1 || args[0] != "list" {
+		return errUsage
+	}
+	e, cancel, err := newCommandEnv()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	info, err := mono.NewClient(e.cfg.MonoAPIURL, e.cfg.MonobankAPIToken).ClientInfo(e.ctx)
+	if err != nil {
+		return err
+	}
+	ffi := newFireflyiiiConnection(e.cfg, nopRecorder{})
+	mappings, err := ffi.AccountMappings(e.ctx)
+	if err != nil {
+		return err
+	}
+	synced := map[string]string{}
+	for _, v := range mappings {
+		synced[v.Source+":"+v.AccountID] = v.DestinationName
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SOURCE\tACCOUNT\tTYPE\tCURRENCY\tNAME\tFIREFLY-III ACCOUNT")
+	row := func(source, id, kind string, currency int32, name string) {
+		code, _ := iso4217.ByCode(int(currency))
+		dest, ok := synced[source+":"+id]
+		if !ok {
+			dest = "-"
+		}
+		delete(synced, source+":"+id)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", source, id, kind, code, name, dest)
+	}
+	for _, v := range info.Accounts {
+		row("mono", v.ID, v.Type, v.CurrencyCode, strings.Join(v.MaskedPan, ","))
+	}
+	for _, v := range info.Jars {
+		row("mono", v.ID, "jar", v.CurrencyCode, v.Title)
+	}
+	// Accounts of other sources are known from firefly-iii side only
+	for _, v := range mappings {
+		if _, ok := synced[v.Source+":"+v.AccountID]; ok {
+			fmt.Fprintf(w, "%s\t%s\t-\t-\t-\t%s\n", v.Source, v.AccountID, v.DestinationName)
+		}
+	}
+	return w.Flush()
+}
+
+// webhookCommand shows, registers, unregisters monobank webhook or rotates its path
+func webhookCommand(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	e, cancel, err := newCommandEnv()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	if args[0] == "rotate" {
+		if _, err := mono.RotateWebhookPath(e.st); err != nil {
+			return fmt.Errorf("Failed to rotate webhook path: %w", err)
+		}
+		fmt.Println("Webhook path rotated. Restart the app to register new webhook url")
+		return nil
+	}
+
+	client := mono.NewClient(e.cfg.MonoAPIURL, e.cfg.MonobankAPIToken)
+	mb, err := newMonoConnection(e.cfg, e.st, client)
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "status":
+		info, err := client.ClientInfo(e.ctx)
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.WebHookURL == "":
+			fmt.Println("Webhook is not registered")
+		case info.WebHookURL == mb.WebhookURL():
+			fmt.Printf("Webhook is registered: %s\n", info.WebHookURL)
+		default:
+			fmt.Printf("Webhook is registered to another url: %s\nExpected url: %s\n", info.WebHookURL, mb.WebhookURL())
+		}
+		return nil
+	case "register":
+		if e.cfg.FBSHost == "" {
+			return errors.New("FBS_HOST is required to register webhook")
+		}
+		// Monobank checks the url responds, so the daemon has to be running
+		if err := client.SetWebhook(e.ctx, mb.WebhookURL()); err != nil {
+			return err
+		}
+		fmt.Printf("Webhook is registered: %s\n", mb.WebhookURL())
+		return nil
+	case "unregister":
+		if err := client.SetWebhook(e.ctx, ""); err != nil {
+			return err
+		}
+		fmt.Println("Webhook is unregistered")
+		return nil
+	default:
+		return errUsage
+	}
+}
+
+// configCommand validates configuration
+func configCommand(args []string) error {
+	if len(args) != 1 || args[0] != "validate" {
+		return errUsage
+	}
+	cfg, err := loadConfig(io.Discard)
+	if err != nil {
+		return err
+	}
+	if err := validateConfig(cfg); err != nil {
+		return err
+	}
+	fmt.Println("Configuration is valid")
+	return nil
+}
+
+// healthCommand requests liveness endpoint of the running daemon, it is used by
+// docker healthcheck. The address follows configuration, credentials are not required
+func healthCommand(args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	cfg, err := cnf.ParsePartial()
+	if err != nil {
+		return err
+	}
+	addr := cfg.HealthListenAddr
+	if addr == "" {
+		addr = cfg.ListenAddr
+	}
+	if addr == listenDisabled {
+		return fmt.Errorf("Health endpoints are not served, set %s", cnf.Name("HEALTH_LISTEN_ADDRESS"))
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	cl := &http.Client{Timeout: time.Second * 5}
+	resp, err := cl.Get("http://" + net.JoinHostPort(host, port) + "/healthz")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(os.Stdout, resp.Body); err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Health check failed with status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// dryRunCommand runs backfill or import printing firefly-iii payloads instead of creating transactions
+func dryRunCommand(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch args[0] {
+	case "backfill":
+		return backfillCommand(true)(args[1:])
+	case "import":
+		return importCommand(true)(args[1:])
+	default:
+		return fmt.Errorf("%w: dry-run supports backfill and import only", errUsage)
+	}
+}
+
+// smsCommand shows which sms template matches a notification text and what is extracted from it
+func smsCommand(args []string) error {
+	if len(args) == 0 || args[0] != "test" {
+		return errUsage
+	}
+	// Templates file defaults to the configured one, credentials are not required
+	cfg, err := cnf.ParsePartial()
+	if err != nil {
+		return fmt.Errorf("Failed to parse configuration: %w", err)
+	}
+	fs := flag.NewFlagSet("sms test", flag.ContinueOnError)
+	templatesFile := fs.String("templates", cfg.SMSTemplatesFile, "json file with additional templates")
+	if err := fs.Parse(args[1:]); err != nil {
+		return errUsage
+	}
+
+	text := strings.Join(fs.Args(), " ")
+	if text == "" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		text = string(data)
+	}
+	templates, err := sms.NewTemplates(*templatesFile)
+	if err != nil {
+		return err
+	}
+	m, err := sms.MatchTemplates(templates, text)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Template: %s (%s)\n", m.Template.Name, m.Template.Bank)
+	fmt.Printf("Amount:    %s\nCurrency:  %s\nMerchant:  %s\nCard:      %s\nBalance:   %s\nDirection: %s\n",
+		m.Amount, m.Currency, m.Merchant, m.Card, m.Balance, m.Direction)
+
+	trans, err := m.ToTransactionDTO(text, time.Now())
+	if err != nil {
+		return err
+	}
+	out, _ := json.MarshalIndent(trans, "", "  ")
+	fmt.Println(string(out))
+	return nil
+}
+
+// rulesTestResult is a sample transaction with rules applied to it
+type rulesTestResult struct {
+	ID string `json:"id"`
+	rules.Result
+	Transaction *dto.TransactionDTO `json:"transaction,omitempty"`
+}
+
+// rulesCommand shows rules matching sample transactions and the transactions they result in
+func rulesCommand(args []string) error {
+	if len(args) == 0 || args[0] != "test" {
+		return errUsage
+	}
+	// Files default to the configured ones, bank and firefly-iii credentials are not required
+	cfg, err := cnf.ParsePartial()
+	if err != nil {
+		return fmt.Errorf("Failed to parse configuration: %w", err)
+	}
+	fs := flag.NewFlagSet("rules test", flag.ContinueOnError)
+	rulesFile := fs.String("rules", cfg.RulesFile, "json file with rules")
+	source := fs.String("source", "monobank", "source name transactions are received from")
+	aliasesFile := fs.String("aliases", cfg.PayeeAliasesFile, "json file with payee aliases")
+	if err := fs.Parse(args[1:]); err != nil || fs.NArg() > 1 {
+		return errUsage
+	}
+
+	in := os.Stdin
+	if fs.NArg() == 1 {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	transactions := []*dto.TransactionDTO{}
+	if err := json.NewDecoder(in).Decode(&transactions); err != nil {
+		return err
+	}
+	list, err := rules.Load(*rulesFile)
+	if err != nil {
+		return err
+	}
+	budgetList, err := budgets(cfg)
+	if err != nil {
+		return err
+	}
+	engine := rules.NewEngine(list, budgetList)
+	aliases, err := payee.LoadAliases(*aliasesFile)
+	if err != nil {
+		return err
+	}
+	payees, err := payee.New(aliases, nil)
+	if err != nil {
+		return err
+	}
+	for _, trans := range transactions {
+		res := rulesTestResult{ID: trans.Transaction.ID, Result: engine.Apply(*source, trans)}
+		if !res.Drop {
+			payees.Apply(trans)
+			res.Transaction = trans
+		}
+		out, _ := json.MarshalIndent(res, "", "  ")
+		fmt.Println(string(out))
+	}
+	return nil
+}
+
+// nopRecorder is used by commands not changing journal
+type nopRecorder struct{}
+
+func (nopRecorder) Payload(id string, payload []byte)   {}
+func (nopRecorder) Finish(id, status string, err error) {}
+
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation(time.DateOnly, s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
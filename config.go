@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+	"github.com/sudores/firefly-iii-bank-sync/bank/mailbox"
+	"github.com/sudores/firefly-iii-bank-sync/bank/mono"
+	"github.com/sudores/firefly-iii-bank-sync/bank/sms"
+	"github.com/sudores/firefly-iii-bank-sync/cnf"
+	firelfyiii "github.com/sudores/firefly-iii-bank-sync/dest/fireflyiii"
+	"github.com/sudores/firefly-iii-bank-sync/payee"
+	"github.com/sudores/firefly-iii-bank-sync/rules"
+	"github.com/sudores/firefly-iii-bank-sync/store"
+	"github.com/sudores/firefly-iii-bank-sync/tracing"
+)
+
+// loadConfig parses configuration and setups logging to out. Configuration is
+// to be checked with validateConfig
+func loadConfig(out io.Writer) (*cnf.Cnf, error) {
+	cfg, err := cnf.Parse()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse configuration: %w", err)
+	}
+	loggingInit(cfg.LogLevel, out)
+	log.Info().Msg("Logging setup success")
+	return cfg, nil
+}
+
+// validateConfig checks values env parsing does not. All the found problems are returned
+func validateConfig(cfg *cnf.Cnf) error {
+	errs := []error{}
+	if _, err := zerolog.ParseLevel(cfg.LogLevel); err != nil {
+		errs = append(errs, fmt.Errorf(`%s "%s" is unrecognized. Eligible levels are: trace, debug, info, warn, error, fatal, panic`,
+			cnf.Name("LOG_LEVEL"), cfg.LogLevel))
+	}
+	if _, err := mono.ParseNets(cfg.MonoWebhookAllowedIPs); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", cnf.Name("MONO_WEBHOOK_ALLOWED_IPS"), err))
+	}
+	if cfg.MonoMode != mono.ModeWebhook && cfg.MonoMode != mono.ModePolling {
+		errs = append(errs, fmt.Errorf(`%s "%s" is unrecognized. Eligible modes are: webhook, polling`, cnf.Name("MONO_MODE"), cfg.MonoMode))
+	}
+	if cfg.MonoMode == mono.ModeWebhook && cfg.FBSHost == "" {
+		errs = append(errs, fmt.Errorf("%s is required in webhook mode", cnf.Name("FBS_HOST")))
+	}
+	if cfg.ListenAddr == listenDisabled {
+		switch {
+		case cfg.MonoMode == mono.ModeWebhook:
+			errs = append(errs, fmt.Errorf("%s is required in webhook mode", cnf.Name("LISTEN_ADDRESS")))
+		case cfg.SMSWebhookPath != "":
+			errs = append(errs, fmt.Errorf("%s is required by %s", cnf.Name("LISTEN_ADDRESS"), cnf.Name("SMS_WEBHOOK_PATH")))
+		case cfg.AdminToken != "" || cfg.AdminViewerToken != "":
+			errs = append(errs, fmt.Errorf("%s is required by admin api", cnf.Name("LISTEN_ADDRESS")))
+		}
+	}
+	switch cfg.HealthListenAddr {
+	case "":
+	case listenDisabled:
+		errs = append(errs, fmt.Errorf("%s can not be disabled, leave it empty to serve health on %s",
+			cnf.Name("HEALTH_LISTEN_ADDRESS"), cnf.Name("LISTEN_ADDRESS")))
+	case cfg.ListenAddr:
+		errs = append(errs, fmt.Errorf("%s must differ from %s", cnf.Name("HEALTH_LISTEN_ADDRESS"), cnf.Name("LISTEN_ADDRESS")))
+	}
+	if cfg.AdminViewerToken != "" && cfg.AdminViewerToken == cfg.AdminToken {
+		errs = append(errs, fmt.Errorf("%s must differ from %s", cnf.Name("ADMIN_VIEWER_TOKEN"), cnf.Name("ADMIN_TOKEN")))
+	}
+	switch cfg.TracingExporter {
+	case tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+	default:
+		errs = append(errs, fmt.Errorf(`%s "%s" is unrecognized. Eligible exporters are: stdout, otlp`, cnf.Name("TRACING_EXPORTER"), cfg.TracingExporter))
+	}
+	if _, err := rules.Load(cfg.RulesFile); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", cnf.Name("RULES_FILE"), err))
+	}
+	if _, err := budgets(cfg); err != nil {
+		errs = append(errs, fmt.Errorf("firefly.budgets: %w", err))
+	}
+	if _, err := payee.LoadAliases(cfg.PayeeAliasesFile); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", cnf.Name("PAYEE_ALIASES_FILE"), err))
+	}
+	if cfg.SMSWebhookPath != "" && cfg.SMSWebhookSecret == "" {
+		errs = append(errs, fmt.Errorf("%s is required with %s", cnf.Name("SMS_WEBHOOK_SECRET"), cnf.Name("SMS_WEBHOOK_PATH")))
+	}
+	if _, err := sms.NewTemplates(cfg.SMSTemplatesFile); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", cnf.Name("SMS_TEMPLATES_FILE"), err))
+	}
+	if cfg.IMAPAddress != "" && cfg.IMAPParsersFile != "" {
+		if _, err := mailbox.LoadParsers(cfg.IMAPParsersFile); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", cnf.Name("IMAP_PARSERS_FILE"), err))
+		}
+	}
+	if cfg.JournalSize <= 0 {
+		errs = append(errs, fmt.Errorf("%s must be positive", cnf.Name("JOURNAL_SIZE")))
+	}
+	if cfg.FFIWorkers <= 0 {
+		errs = append(errs, fmt.Errorf("%s must be positive", cnf.Name("FFI_WORKERS")))
+	}
+	if cfg.FFIQueueSize < 0 {
+		errs = append(errs, fmt.Errorf("%s must not be negative", cnf.Name("FFI_QUEUE_SIZE")))
+	}
+	if cfg.FFIBillsCheckInterval < 0 {
+		errs = append(errs, fmt.Errorf("%s must not be negative", cnf.Name("FFI_BILLS_CHECK_INTERVAL")))
+	}
+	if cfg.FFIBillsGrace < 0 {
+		errs = append(errs, fmt.Errorf("%s must not be negative", cnf.Name("FFI_BILLS_GRACE")))
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("%s must be positive", cnf.Name("SHUTDOWN_TIMEOUT")))
+	}
+	for i, v := range cfg.FFIAccounts {
+		if v.AccountID == "" || v.FireflyID == "" {
+			errs = append(errs, fmt.Errorf("firefly.accounts[%d]: account and firefly_id are required", i))
+		}
+	}
+	for i, v := range cfg.FFIBudgets {
+		if v.Budget == "" || (len(v.Categories) == 0 && len(v.MCC) == 0) {
+			errs = append(errs, fmt.Errorf("firefly.budgets[%d]: budget and categories or mcc are required", i))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// newMonoConnection builds monobank source of validated configuration
+func newMonoConnection(cfg *cnf.Cnf, st *store.Store, client *mono.Client) (*mono.MonoConnection, error) {
+	allowedNets, err := mono.ParseNets(cfg.MonoWebhookAllowedIPs)
+	if err != nil {
+		return nil, err
+	}
+	webhookPath, err := mono.WebhookPath(st, cfg.MonoWebhookPath)
+	if err != nil {
+		return nil, err
+	}
+	return mono.NewMonoConnetion(client, st, mono.Options{
+		Mode:             cfg.MonoMode,
+		FBSHost:          cfg.FBSHost,
+		WebhookPath:      webhookPath,
+		WatchdogInterval: cfg.MonoWatchdogInterval,
+		Auth: mono.WebhookAuth{
+			AllowedNets:     allowedNets,
+			RealIPHeader:    cfg.MonoWebhookRealIPHeader,
+			Secret:          cfg.MonoWebhookSecret,
+			VerifyStatement: cfg.MonoWebhookVerifyStatement,
+		},
+		PollInterval: cfg.MonoPollInterval,
+		PollAccounts: cfg.MonoPollAccounts,
+	})
+}
+
+// newFireflyiiiConnection builds firefly-iii destination with configured account mappings
+func newFireflyiiiConnection(cfg *cnf.Cnf, recorder firelfyiii.Recorder) *firelfyiii.FireflyiiiConnection {
+	ffi := firelfyiii.NewFireflyiiiConnection(cfg.FFIToken, cfg.FFIURL, cfg.FFIWorkers, cfg.FFIQueueSize, recorder)
+	ffi.SetAccounts(accountMappings(cfg))
+	ffi.SetBills(cfg.FFIBills)
+	return ffi
+}
+
+// newRulesEngine builds engine of rules from RULES_FILE and budgets of firefly.budgets
+func newRulesEngine(cfg *cnf.Cnf) (*rules.Engine, error) {
+	list, err := rules.Load(cfg.RulesFile)
+	if err != nil {
+		return nil, err
+	}
+	budgetList, err := budgets(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return rules.NewEngine(list, budgetList), nil
+}
+
+// budgets returns compiled budgets configured with firefly.budgets
+func budgets(cfg *cnf.Cnf) ([]rules.Budget, error) {
+	list := []rules.Budget{}
+	for _, v := range cfg.FFIBudgets {
+		list = append(list, rules.Budget{Budget: v.Budget, Categories: v.Categories, MCC: v.MCC})
+	}
+	return rules.CompileBudgets(list)
+}
+
+// newPayeeNormalizer builds payee normalizer of PAYEE_* configuration, nil when
+// payee accounts are disabled. Names of stable keys are persisted to st
+func newPayeeNormalizer(cfg *cnf.Cnf, st *store.Store) (*payee.Normalizer, error) {
+	if !cfg.PayeeAccounts {
+		return nil, nil
+	}
+	aliases, err := payee.LoadAliases(cfg.PayeeAliasesFile)
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.PayeeStableKeys {
+		st = nil
+	}
+	return payee.New(aliases, st)
+}
+
+// accountMappings returns account mappings configured with firefly.accounts
+func accountMappings(cfg *cnf.Cnf) []dto.AccountMapping {
+	mappings := []dto.AccountMapping{}
+	for _, v := range cfg.FFIAccounts {
+		mappings = append(mappings, dto.AccountMapping{Source: v.Source, AccountID: v.AccountID, DestinationID: v.FireflyID})
+	}
+	return mappings
+}
@@ -0,0 +1,183 @@
+package firelfyiii
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+)
+
+// billMatcher is an active firefly-iii bill prepared for matching withdrawals
+type billMatcher struct {
+	id        string
+	name      string
+	currency  string
+	amountMin float64
+	amountMax float64
+	// patterns - fbs.match:<regex> lines of bill notes, bill name is matched when none
+	patterns []*regexp.Regexp
+}
+
+// UnpaidBill is a bill expected to be paid in a period with no payment found
+type UnpaidBill struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Expected time.Time `json:"expected"`
+}
+
+// SetBills enables matching withdrawals to active firefly-iii bills
+func (f *FireflyiiiConnection) SetBills(enabled bool) {
+	f.billsEnabled.Store(enabled)
+}
+
+// matchBills links withdrawal splits to the first active bill matching split amount
+// and payee or description. Bills failed to be fetched are logged and not linked
+func (f *FireflyiiiConnection) matchBills(ctx context.Context, trans *dto.TransactionDTO, tr *transaction) {
+	if !f.billsEnabled.Load() {
+		return
+	}
+	for i := range tr.Transactions {
+		s := &tr.Transactions[i]
+		if s.Type != "withdrawal" || s.BillID != "" || s.BillName != "" {
+			continue
+		}
+		bills, err := f.activeBills(ctx)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to get bills")
+			return
+		}
+		amount, _ := strconv.ParseFloat(s.Amount, 64)
+		for _, b := range bills {
+			if b.match(amount, s.CurrencyCode, s.DestinationName, trans.Transaction.CounterName, s.Description) {
+				log.Debug().Msgf("Transaction %s matched bill %q", trans.Transaction.ID, b.name)
+				s.BillID = b.id
+				break
+			}
+		}
+	}
+}
+
+func (b *billMatcher) match(amount float64, currency string, texts ...string) bool {
+	if amount < b.amountMin || amount > b.amountMax {
+		return false
+	}
+	if b.currency != "" && currency != "" && b.currency != currency {
+		return false
+	}
+	for _, text := range texts {
+		if text == "" {
+			continue
+		}
+		if len(b.patterns) == 0 && strings.Contains(strings.ToLower(text), strings.ToLower(b.name)) {
+			return true
+		}
+		for _, re := range b.patterns {
+			if re.MatchString(text) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// activeBills returns active bills cached for billsCacheTTL
+func (f *FireflyiiiConnection) activeBills(ctx context.Context) ([]billMatcher, error) {
+	f.billsMu.Lock()
+	defer f.billsMu.Unlock()
+	if time.Since(f.billsFetched) < billsCacheTTL {
+		return f.bills, nil
+	}
+	list, err := f.getBillList(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	f.bills = []billMatcher{}
+	for _, v := range list.Data {
+		if !v.Attributes.Active {
+			continue
+		}
+		b := billMatcher{id: v.ID, name: v.Attributes.Name, currency: v.Attributes.CurrencyCode}
+		b.amountMin, _ = strconv.ParseFloat(v.Attributes.AmountMin, 64)
+		b.amountMax, _ = strconv.ParseFloat(v.Attributes.AmountMax, 64)
+		for _, p := range extractFBSMatches(v.Attributes.Notes) {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				log.Warn().Err(err).Msgf("Bill %q has invalid match pattern", b.name)
+				continue
+			}
+			b.patterns = append(b.patterns, re)
+		}
+		f.bills = append(f.bills, b)
+	}
+	f.billsFetched = time.Now()
+	return f.bills, nil
+}
+
+// UnpaidBills returns active bills expected to be paid from start till end which
+// have no payment from grace before the expected date till now
+func (f *FireflyiiiConnection) UnpaidBills(ctx context.Context, start, end time.Time, grace time.Duration) ([]UnpaidBill, error) {
+	now := time.Now()
+	query := url.Values{
+		"start": {start.Add(-grace).Format(time.DateOnly)},
+		"end":   {now.Format(time.DateOnly)},
+	}
+	list, err := f.getBillList(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	unpaid := []UnpaidBill{}
+	for _, v := range list.Data {
+		if !v.Attributes.Active {
+			continue
+		}
+		for _, d := range v.Attributes.PayDates {
+			expected, err := time.Parse(time.RFC3339, d)
+			if err != nil || expected.Before(start) || !expected.Before(end) {
+				continue
+			}
+			if !v.paidSince(expected.Add(-grace)) {
+				unpaid = append(unpaid, UnpaidBill{ID: v.ID, Name: v.Attributes.Name, Expected: expected})
+			}
+		}
+	}
+	return unpaid, nil
+}
+
+func (b *bill) paidSince(t time.Time) bool {
+	for _, p := range b.Attributes.PaidDates {
+		if paid, err := time.Parse(time.RFC3339, p.Date); err == nil && !paid.Before(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *FireflyiiiConnection) getBillList(ctx context.Context, query url.Values) (*bills, error) {
+	list := bills{}
+	for page := 1; ; page++ {
+		res := bills{}
+		if err := f.getPage(ctx, fireflyiiiBillsPath, query, page, &res); err != nil {
+			return nil, err
+		}
+		list.Data = append(list.Data, res.Data...)
+		if page >= res.Meta.Pagination.TotalPages {
+			return &list, nil
+		}
+	}
+}
+
+// extractFBSMatches returns patterns of fbs.match:<regex> lines of notes
+func extractFBSMatches(notes string) []string {
+	patterns := []string{}
+	for _, line := range strings.Split(notes, "\n") {
+		if p, ok := strings.CutPrefix(strings.TrimSpace(line), billMatchPrefix); ok && p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
@@ -0,0 +1,116 @@
+package firelfyiii
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestBillMatch(t *testing.T) {
+	byName := &billMatcher{name: "Netflix", currency: "UAH", amountMin: 300, amountMax: 350}
+	byPattern := &billMatcher{name: "Rent", amountMin: 15000, amountMax: 15000,
+		patterns: []*regexp.Regexp{regexp.MustCompile(`(?i)^ivan petrenko$`)}}
+	tests := []struct {
+		bill     *billMatcher
+		amount   float64
+		currency string
+		texts    []string
+		want     bool
+	}{
+		{byName, 329.5, "UAH", []string{"NETFLIX.COM"}, true},
+		// Amount range includes its bounds
+		{byName, 300, "UAH", []string{"Netflix"}, true},
+		{byName, 350, "UAH", []string{"Netflix"}, true},
+		{byName, 299.99, "UAH", []string{"Netflix"}, false},
+		{byName, 350.01, "UAH", []string{"Netflix"}, false},
+		{byName, 329.5, "USD", []string{"Netflix"}, false},
+		// Currency unknown to either side is not compared
+		{byName, 329.5, "", []string{"Netflix"}, true},
+		{byName, 329.5, "UAH", []string{"", "Payment for netflix"}, true},
+		{byName, 329.5, "UAH", []string{"Spotify"}, false},
+		{byPattern, 15000, "UAH", []string{"Ivan Petrenko"}, true},
+		// Bill name is not matched when it has patterns
+		{byPattern, 15000, "UAH", []string{"Rent"}, false},
+		{byPattern, 14999, "UAH", []string{"Ivan Petrenko"}, false},
+	}
+	for i, tt := range tests {
+		if got := tt.bill.match(tt.amount, tt.currency, tt.texts...); got != tt.want {
+			t.Errorf("%d: bill %q match(%v, %q, %q) = %t, want %t",
+				i, tt.bill.name, tt.amount, tt.currency, tt.texts, got, tt.want)
+		}
+	}
+}
+
+const testBills = `{"data": [
+	{"id": "1", "attributes": {"name": "Netflix", "amount_min": "300", "amount_max": "350",
+		"currency_code": "UAH", "active": true,
+		"pay_dates": ["2026-10-05T00:00:00+00:00"], "paid_dates": [{"date": "2026-10-04T12:00:00+00:00"}]}},
+	{"id": "2", "attributes": {"name": "Rent", "amount_min": "15000", "amount_max": "15000",
+		"currency_code": "UAH", "active": true, "notes": "fbs.match:(?i)petrenko\nfbs.match:(",
+		"pay_dates": ["2026-10-01T00:00:00+00:00", "2026-11-01T00:00:00+00:00"], "paid_dates": []}},
+	{"id": "3", "attributes": {"name": "Gym", "amount_min": "0", "amount_max": "1000",
+		"currency_code": "UAH", "active": false,
+		"pay_dates": ["2026-10-10T00:00:00+00:00"], "paid_dates": []}}
+]}`
+
+func TestMatchBills(t *testing.T) {
+	fake := newFakeFirefly(t)
+	fake.handlers[fireflyiiiAPIPath+fireflyiiiBillsPath] = func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, testBills)
+	}
+	f := NewFireflyiiiConnection("token", fake.URL, 1, 1, nopRecorder{})
+	f.SetBills(true)
+
+	tests := []struct {
+		counter string
+		amount  int64
+		want    string
+	}{
+		{"NETFLIX.COM", -32950, "1"},
+		{"Ivan Petrenko", -1500000, "2"},
+		// Inactive bill
+		{"Gym", -50000, ""},
+		{"NETFLIX.COM", -1500000, ""},
+	}
+	for _, tt := range tests {
+		trans := testTransaction("acc1", "t1")
+		trans.Transaction.Amount = tt.amount
+		trans.Transaction.CurrencyCode = 980
+		trans.Transaction.CounterName = tt.counter
+		tr := transactionDTOToTransaction(trans)
+		f.matchBills(context.Background(), trans, tr)
+		if got := tr.Transactions[0].BillID; got != tt.want {
+			t.Errorf("bill of %q %d = %q, want %q", tt.counter, tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestUnpaidBills(t *testing.T) {
+	fake := newFakeFirefly(t)
+	var query map[string][]string
+	fake.handlers[fireflyiiiAPIPath+fireflyiiiBillsPath] = func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		fmt.Fprint(w, testBills)
+	}
+	f := NewFireflyiiiConnection("token", fake.URL, 1, 1, nopRecorder{})
+	start := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+
+	unpaid, err := f.UnpaidBills(context.Background(), start, end, 3*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Netflix is paid within grace, the second rent date is out of the period and
+	// the inactive bill is skipped
+	want := []UnpaidBill{{ID: "2", Name: "Rent", Expected: start}}
+	if len(unpaid) != 1 || unpaid[0].ID != want[0].ID || !unpaid[0].Expected.Equal(want[0].Expected) {
+		t.Errorf("unpaid bills = %v, want %v", unpaid, want)
+	}
+	if got := query["start"]; !reflect.DeepEqual(got, []string{"2026-09-28"}) {
+		t.Errorf("bills start = %v, want grace before period start", got)
+	}
+}
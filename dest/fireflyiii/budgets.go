@@ -0,0 +1,70 @@
+package firelfyiii
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// resolveBudgets sets budget ids of transaction splits by their budget names.
+// Budgets not resolved are left to firefly-iii by name
+func (f *FireflyiiiConnection) resolveBudgets(ctx context.Context, tr *transaction) {
+	for i := range tr.Transactions {
+		s := &tr.Transactions[i]
+		if s.BudgetName == "" || s.BudgetID != "" {
+			continue
+		}
+		id, err := f.budgetID(ctx, s.BudgetName)
+		if err != nil {
+			log.Warn().Err(err).Msgf("Failed to resolve budget %q", s.BudgetName)
+			continue
+		}
+		if id == "" {
+			log.Warn().Msgf("Budget %q is not found in firefly-iii", s.BudgetName)
+			continue
+		}
+		s.BudgetID = id
+	}
+}
+
+// budgetID returns id of budget by name, empty if there is none. Budgets are
+// cached for budgetsCacheTTL, so renamed, deleted and new budgets are picked up
+func (f *FireflyiiiConnection) budgetID(ctx context.Context, name string) (string, error) {
+	f.budgetsMu.Lock()
+	defer f.budgetsMu.Unlock()
+	if time.Since(f.budgetsFetched) < budgetsCacheTTL {
+		return f.budgetIDs[name], nil
+	}
+	list, err := f.getBudgetList(ctx)
+	if err != nil {
+		return "", err
+	}
+	f.budgetIDs = map[string]string{}
+	for _, v := range list.Data {
+		f.budgetIDs[v.Attributes.Name] = v.ID
+	}
+	f.budgetsFetched = time.Now()
+	return f.budgetIDs[name], nil
+}
+
+// expireBudgets makes budgets to be fetched again on the next lookup
+func (f *FireflyiiiConnection) expireBudgets() {
+	f.budgetsMu.Lock()
+	defer f.budgetsMu.Unlock()
+	f.budgetsFetched = time.Time{}
+}
+
+func (f *FireflyiiiConnection) getBudgetList(ctx context.Context) (*budgets, error) {
+	list := budgets{}
+	for page := 1; ; page++ {
+		res := budgets{}
+		if err := f.getPage(ctx, fireflyiiiBudgetsPath, nil, page, &res); err != nil {
+			return nil, err
+		}
+		list.Data = append(list.Data, res.Data...)
+		if page >= res.Meta.Pagination.TotalPages {
+			return &list, nil
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package firelfyiii
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBudgetID(t *testing.T) {
+	fake := newFakeFirefly(t)
+	list := `{"data": [{"id": "1", "attributes": {"name": "Food"}}]}`
+	fetched := 0
+	fake.handlers[fireflyiiiAPIPath+fireflyiiiBudgetsPath] = func(w http.ResponseWriter, r *http.Request) {
+		fetched++
+		fmt.Fprint(w, list)
+	}
+	f := NewFireflyiiiConnection("token", fake.URL, 1, 1, nopRecorder{})
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		expire  bool
+		want    string
+		fetched int
+	}{
+		{"Food", false, "1", 1},
+		{"Food", false, "1", 1},
+		// Unknown names are not fetched again while the cache is fresh
+		{"Transport", false, "", 1},
+		{"Food", true, "2", 2},
+		{"Transport", false, "3", 2},
+	}
+	for i, tt := range tests {
+		if tt.expire {
+			// Budget Food is recreated and Transport is added
+			list = `{"data": [{"id": "2", "attributes": {"name": "Food"}}, {"id": "3", "attributes": {"name": "Transport"}}]}`
+			f.budgetsFetched = time.Now().Add(-budgetsCacheTTL)
+		}
+		id, err := f.budgetID(ctx, tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != tt.want || fetched != tt.fetched {
+			t.Errorf("%d: budget %q = %q, fetched %d times, want %q, fetched %d times",
+				i, tt.name, id, fetched, tt.want, tt.fetched)
+		}
+	}
+}
+
+func TestCreateTransactionExpiresBudgetsOnInvalidID(t *testing.T) {
+	fake := newFakeFirefly(t)
+	budgetID := "1"
+	fake.handlers[fireflyiiiAPIPath+fireflyiiiBudgetsPath] = func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"data": [{"id": %q, "attributes": {"name": "Food"}}]}`, budgetID)
+	}
+	f := NewFireflyiiiConnection("token", fake.URL, 1, 1, nopRecorder{})
+	ctx := context.Background()
+	if id, _ := f.budgetID(ctx, "Food"); id != "1" {
+		t.Fatalf("budget id = %q, want 1", id)
+	}
+
+	// Budget is deleted and created again in firefly-iii, the cached id is rejected
+	budgetID = "2"
+	fake.mu.Lock()
+	fake.reject = `{"message": "The given data was invalid.", "errors": {"transactions.0.budget_id": ["Invalid budget"]}}`
+	fake.mu.Unlock()
+	trans := testTransaction("acc1", "t1")
+	trans.Budget = "Food"
+	if err := f.createTransaction(ctx, trans); err == nil {
+		t.Fatal("rejected transaction is not reported")
+	}
+	if id, _ := f.budgetID(ctx, "Food"); id != "2" {
+		t.Errorf("budget id after rejection = %q, want 2", id)
+	}
+}
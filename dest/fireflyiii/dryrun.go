@@ -0,0 +1,57 @@
+package firelfyiii
+
+import (
+	"encoding/json"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DryRunResult is a transaction rendered in dry run with decisions taken on it
+type DryRunResult struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Transfer bool   `json:"transfer"`
+	// SourceAccount, DestinationAccount - names of resolved firefly-iii accounts
+	SourceAccount      string          `json:"source_account"`
+	DestinationAccount string          `json:"destination_account"`
+	Category           string          `json:"category"`
+	Budget             string          `json:"budget,omitempty"`
+	BudgetID           string          `json:"budget_id,omitempty"`
+	BillID             string          `json:"bill_id,omitempty"`
+	Tags               []string        `json:"tags"`
+	ForeignAmount      string          `json:"foreign_amount,omitempty"`
+	Payload            json.RawMessage `json:"payload"`
+}
+
+// renderDryRun writes transaction payload with decisions taken to dry run output
+func (f *FireflyiiiConnection) renderDryRun(id string, tr *transaction, body []byte) error {
+	split := tr.Transactions[0]
+	res := DryRunResult{
+		ID:                 id,
+		Type:               split.Type,
+		Transfer:           split.Type == "transfer",
+		SourceAccount:      split.SourceName,
+		DestinationAccount: split.DestinationName,
+		Category:           split.CategoryName,
+		Budget:             split.BudgetName,
+		BudgetID:           split.BudgetID,
+		BillID:             split.BillID,
+		Tags:               split.Tags,
+		Payload:            body,
+	}
+	if split.ForeignAmount != "" {
+		res.ForeignAmount = split.ForeignAmount + " " + split.ForeignCurrencyCode
+	}
+	f.dryRunMu.Lock()
+	defer f.dryRunMu.Unlock()
+	if f.dryRunOut == nil {
+		log.Info().Interface("dry_run", res).Msgf("Transaction %s is not created in dry run", id)
+		return nil
+	}
+	out, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = f.dryRunOut.Write(append(out, '\n'))
+	return err
+}
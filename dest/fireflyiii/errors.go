@@ -4,4 +4,6 @@ import "errors"
 
 var (
 	ErrFBSConfigNotFound = errors.New("Valid fbs config not found for any account")
+	ErrUnauthorized      = errors.New("Firefly-iii token is invalid")
+	ErrDuplicate         = errors.New("Firefly-iii rejected transaction as a duplicate")
 )
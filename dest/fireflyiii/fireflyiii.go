@@ -8,58 +8,147 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+	"github.com/sudores/firefly-iii-bank-sync/metrics"
+	"github.com/sudores/firefly-iii-bank-sync/tracing"
 	"github.com/sudores/firefly-iii-bank-sync/util"
 )
 
+// Statuses of transaction creation reported to Recorder
+const (
+	StatusCreated   = "created"
+	StatusDuplicate = "duplicate"
+	StatusFailed    = "failed"
+	// StatusDryRun - transaction was rendered in dry run, not created
+	StatusDryRun = "dry-run"
+	// StatusPending - creation was interrupted by shutdown, transaction is to be created on the next start
+	StatusPending = "pending"
+)
+
+// Recorder is notified of transactions creation progress
+type Recorder interface {
+	// Payload is called with request body before it is sent
+	Payload(id string, payload []byte)
+	// Finish is called with status of transaction creation and error of failed one
+	Finish(id, status string, err error)
+}
+
 type FireflyiiiConnection struct {
+	recorder                  Recorder
 	cl                        *http.Client
 	PATToken                  string
 	FireflyiiiURL             string
 	FireflyiiiTransactionChan chan *dto.TransactionDTO
+
+	// workers - number of transactions created in parallel by Serve
+	workers int
+	// queueSize - number of transactions waiting in FireflyiiiTransactionChan,
+	// the same number is split between queues of workers
+	queueSize int
+	// inFlight - number of transactions passed to workers and not created yet
+	inFlight atomic.Int64
+	// writes - workers of Serve, their writes are interrupted with writesCancel on shutdown
+	writes       sync.WaitGroup
+	writesCtx    context.Context
+	writesCancel context.CancelFunc
+
+	// dryRun - transactions are rendered to dryRunOut instead of being created
+	dryRun    atomic.Bool
+	dryRunMu  sync.Mutex
+	dryRunOut io.Writer
+
+	// accounts - bank accounts mapped to firefly-iii account ids in addition to fbs notes
+	accountsMu sync.Mutex
+	accounts   []dto.AccountMapping
+
+	// budgetIDs - firefly-iii budget ids by name fetched at budgetsFetched
+	budgetsMu      sync.Mutex
+	budgetIDs      map[string]string
+	budgetsFetched time.Time
+
+	// bills - active bills fetched at billsFetched, matched to withdrawals when billsEnabled
+	billsEnabled atomic.Bool
+	billsMu      sync.Mutex
+	bills        []billMatcher
+	billsFetched time.Time
+
+	// rates synced by SyncExchangeRates by "FROM/TO" currency pair, ratesStored -
+	// the last ones stored in firefly-iii
+	ratesMu     sync.Mutex
+	rates       map[string]dto.ExchangeRate
+	ratesStored map[string]dto.ExchangeRate
 }
 
-func NewFireflyiiiConnection(PAT, FireflyiiiURL string) *FireflyiiiConnection {
+// NewFireflyiiiConnection builds connection creating transactions with workers in
+// parallel. Up to queueSize transactions wait in FireflyiiiTransactionChan and
+// up to queueSize more wait for workers
+func NewFireflyiiiConnection(PAT, FireflyiiiURL string, workers, queueSize int, recorder Recorder) *FireflyiiiConnection {
+	writesCtx, writesCancel := context.WithCancel(context.Background())
 	return &FireflyiiiConnection{
-		cl:                        &http.Client{Timeout: time.Second * 30},
+		workers:                   workers,
+		queueSize:                 queueSize,
+		writesCtx:                 writesCtx,
+		writesCancel:              writesCancel,
+		recorder:                  recorder,
+		cl:                        tracing.InstrumentClient(destinationName, metrics.InstrumentClient(destinationName, &http.Client{Timeout: time.Second * 30})),
 		PATToken:                  PAT,
 		FireflyiiiURL:             FireflyiiiURL + fireflyiiiAPIPath,
-		FireflyiiiTransactionChan: make(chan *dto.TransactionDTO),
-	}
-}
-
-func (f *FireflyiiiConnection) Serve(ctx context.Context) {
-	for {
-		select {
-		case <-ctx.Done():
-			close(f.FireflyiiiTransactionChan)
-			log.Trace().Msg("Firefly-iii channel is closed")
-		case trans, ok := <-f.FireflyiiiTransactionChan:
-			log.Debug().Msg("ffi Transaction received")
-			go func(trans *dto.TransactionDTO) {
-				if err := f.createTransaction(ctx, trans); err != nil {
-					log.Warn().Err(err).Msgf("Failed to create transaction with id: %s", trans.Transaction.ID)
-				}
-				return
-			}(trans)
-			log.Debug().Msg("ffi Transaction created")
-			if !ok {
-				log.Info().Msg("Shutting down firefly-iii connection. Bye!!!")
-				return
-			}
-		}
+		FireflyiiiTransactionChan: make(chan *dto.TransactionDTO, queueSize),
+		rates:                     map[string]dto.ExchangeRate{},
+		ratesStored:               map[string]dto.ExchangeRate{},
 	}
 }
 
+// SetDryRun makes connection to resolve accounts and render transactions
+// payloads to out instead of creating them. Out may be nil, then results are logged
+func (f *FireflyiiiConnection) SetDryRun(enabled bool, out io.Writer) {
+	f.dryRunMu.Lock()
+	defer f.dryRunMu.Unlock()
+	f.dryRun.Store(enabled)
+	f.dryRunOut = out
+}
+
+// Create creates transaction reporting the result to metrics and recorder
+func (f *FireflyiiiConnection) Create(ctx context.Context, trans *dto.TransactionDTO) error {
+	ctx, span := tracing.Start(ctx, trans, destinationName+".create_transaction")
+	err := f.createTransaction(ctx, trans)
+	tracing.End(span, err)
+	status := StatusCreated
+	switch {
+	case f.dryRun.Load() && err == nil:
+		f.recorder.Finish(trans.Transaction.ID, StatusDryRun, nil)
+		return nil
+	case err != nil && ctx.Err() != nil:
+		f.recorder.Finish(trans.Transaction.ID, StatusPending, err)
+		return err
+	case errors.Is(err, ErrDuplicate):
+		status = StatusDuplicate
+	case err != nil:
+		status = StatusFailed
+	}
+	metrics.ObservePush(destinationName, trans.AccountID, err, errors.Is(err, ErrDuplicate))
+	f.recorder.Finish(trans.Transaction.ID, status, err)
+	return err
+}
+
 func (f *FireflyiiiConnection) createTransaction(ctx context.Context, trans *dto.TransactionDTO) error {
 	if trans.Transaction.Amount == 0 {
 		return errors.New("Transactions with zero amount are not accepted")
 	}
+	f.fillForeignAmount(trans)
+	if trans.TransferAccountID != "" {
+		log.Debug().Msg("Creating transfer")
+		return f.createTransfer(ctx, trans)
+	}
 	if trans.Transaction.Amount < 0 {
 		log.Debug().Msg("Creating withdrawal")
 		if err := f.createWithdrawal(ctx, trans); err != nil {
@@ -84,25 +173,9 @@ func (f *FireflyiiiConnection) createWithdrawal(ctx context.Context, trans *dto.
 	}
 	tr.Transactions[0].SourceID = accountID
 	tr.Transactions[0].SourceName = accountName
+	tr.Transactions[0].DestinationName = trans.CounterAccount
 
-	body, err := json.Marshal(tr)
-	if err != nil {
-		return err
-	}
-	req, err := f.newRequest(ctx, http.MethodPost, fireflyiiiTransactionPath, bytes.NewReader(body))
-	if err != nil {
-		return err
-	}
-
-	resp, err := f.cl.Do(req)
-	if err != nil {
-		return err
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return errors.New(fmt.Sprint("Failed to create transaction, status code: ", resp.StatusCode, " ", string(body)))
-	}
-	return nil
+	return f.postTransaction(ctx, trans, tr)
 }
 
 func (f *FireflyiiiConnection) createDeposit(ctx context.Context, trans *dto.TransactionDTO) error {
@@ -115,11 +188,52 @@ func (f *FireflyiiiConnection) createDeposit(ctx context.Context, trans *dto.Tra
 	}
 	tr.Transactions[0].DestinationID = accountID
 	tr.Transactions[0].DestinationName = accountName
+	tr.Transactions[0].SourceName = trans.CounterAccount
+
+	return f.postTransaction(ctx, trans, tr)
+}
+
+// createTransfer creates transfer between own accounts. Money moves from the
+// transaction account for negative amounts and to it for positive ones
+func (f *FireflyiiiConnection) createTransfer(ctx context.Context, trans *dto.TransactionDTO) error {
+	tr := transactionDTOToTransaction(trans)
+	tr.Transactions[0].Type = "transfer"
+	sourceID, destinationID := trans.AccountID, trans.TransferAccountID
+	if trans.Transaction.Amount > 0 {
+		sourceID, destinationID = destinationID, sourceID
+	}
+	var err error
+	if tr.Transactions[0].SourceID, err = f.getCorrespondingAccountID(ctx, sourceID); err != nil {
+		return err
+	}
+	if tr.Transactions[0].SourceName, err = f.getCorrespondingAccountName(ctx, sourceID); err != nil {
+		return err
+	}
+	if tr.Transactions[0].DestinationID, err = f.getCorrespondingAccountID(ctx, destinationID); err != nil {
+		return err
+	}
+	if tr.Transactions[0].DestinationName, err = f.getCorrespondingAccountName(ctx, destinationID); err != nil {
+		return err
+	}
 
+	return f.postTransaction(ctx, trans, tr)
+}
+
+// postTransaction creates transaction split by trans splits. Transactions rejected
+// by duplicate hash result in ErrDuplicate
+func (f *FireflyiiiConnection) postTransaction(ctx context.Context, trans *dto.TransactionDTO, tr *transaction) error {
+	id := trans.Transaction.ID
+	tr.split(trans)
+	f.resolveBudgets(ctx, tr)
+	f.matchBills(ctx, trans, tr)
 	body, err := json.Marshal(tr)
 	if err != nil {
 		return err
 	}
+	f.recorder.Payload(id, body)
+	if f.dryRun.Load() {
+		return f.renderDryRun(id, tr, body)
+	}
 	req, err := f.newRequest(ctx, http.MethodPost, fireflyiiiTransactionPath, bytes.NewReader(body))
 	if err != nil {
 		return err
@@ -128,17 +242,53 @@ func (f *FireflyiiiConnection) createDeposit(ctx context.Context, trans *dto.Tra
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return errors.New(fmt.Sprint("Failed to create transaction, status code: ", resp.StatusCode, " ", string(body)))
+		respBody, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode == http.StatusUnprocessableEntity && strings.Contains(string(respBody), "Duplicate of transaction") {
+			return ErrDuplicate
+		}
+		if resp.StatusCode == http.StatusUnprocessableEntity && strings.Contains(string(respBody), "budget_id") {
+			// Budget is deleted since it was cached, retry resolves it again
+			f.expireBudgets()
+		}
+		return errors.New(fmt.Sprint("Failed to create transaction, status code: ", resp.StatusCode, " ", string(respBody)))
 	}
 	return nil
 }
 
+// SetAccounts sets bank accounts mapped to firefly-iii accounts by id. They take
+// precedence over accounts configured in notes
+func (f *FireflyiiiConnection) SetAccounts(mappings []dto.AccountMapping) {
+	f.accountsMu.Lock()
+	defer f.accountsMu.Unlock()
+	f.accounts = mappings
+}
+
+// configuredAccountID returns firefly-iii account id bank account is mapped to with SetAccounts
+func (f *FireflyiiiConnection) configuredAccountID(accountID string) string {
+	f.accountsMu.Lock()
+	defer f.accountsMu.Unlock()
+	for _, v := range f.accounts {
+		if v.AccountID == accountID {
+			return v.DestinationID
+		}
+	}
+	return ""
+}
+
 func (f *FireflyiiiConnection) getCorrespondingAccountName(ctx context.Context, accountID string) (string, error) {
 	accounts, err := f.getAccountList(ctx)
 	if err != nil {
 		return "", err
 	}
+	if id := f.configuredAccountID(accountID); id != "" {
+		for _, v := range accounts.Data {
+			if v.ID == id {
+				return v.Attributes.Name, nil
+			}
+		}
+	}
 	for _, v := range accounts.Data {
 		config := extractFBSConfig(v.Attributes.Notes, accountID)
 		if len(config) != 0 {
@@ -151,6 +301,9 @@ func (f *FireflyiiiConnection) getCorrespondingAccountName(ctx context.Context,
 }
 
 func (f *FireflyiiiConnection) getCorrespondingAccountID(ctx context.Context, accountID string) (string, error) {
+	if id := f.configuredAccountID(accountID); id != "" {
+		return id, nil
+	}
 	accounts, err := f.getAccountList(ctx)
 	if err != nil {
 		return "", err
@@ -159,13 +312,50 @@ func (f *FireflyiiiConnection) getCorrespondingAccountID(ctx context.Context, ac
 		config := extractFBSConfig(v.Attributes.Notes, accountID)
 		if len(config) != 0 {
 			if strings.Split(config[0], ":")[1] == accountID {
-				return v.Attributes.ID, nil
+				return v.ID, nil
 			}
 		}
 	}
 	return "", ErrFBSConfigNotFound
 }
 
+// AccountMappings returns bank accounts set with SetAccounts and configured in
+// notes of firefly-iii accounts
+func (f *FireflyiiiConnection) AccountMappings(ctx context.Context) ([]dto.AccountMapping, error) {
+	accounts, err := f.getAccountList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mappings := []dto.AccountMapping{}
+	f.accountsMu.Lock()
+	for _, m := range f.accounts {
+		for _, v := range accounts.Data {
+			if v.ID == m.DestinationID {
+				m.DestinationName = v.Attributes.Name
+			}
+		}
+		mappings = append(mappings, m)
+	}
+	f.accountsMu.Unlock()
+	for _, v := range accounts.Data {
+		config := extractFBSConfig(v.Attributes.Notes, "")
+		if len(config) == 0 {
+			continue
+		}
+		source, accountID, ok := strings.Cut(strings.TrimPrefix(strings.Fields(config[0])[0], "fbs."), ":")
+		if !ok {
+			continue
+		}
+		mappings = append(mappings, dto.AccountMapping{
+			Source:          source,
+			AccountID:       accountID,
+			DestinationID:   v.ID,
+			DestinationName: v.Attributes.Name,
+		})
+	}
+	return mappings, nil
+}
+
 func extractFBSConfig(text, substring string) []string {
 	re := regexp.MustCompile(`fbs\..*`)
 	match := re.FindStringSubmatch(text)
@@ -193,6 +383,53 @@ func (f *FireflyiiiConnection) getAccountList(ctx context.Context) (*accounts, e
 
 }
 
+// getPage requests page (starting with 1) of firefly-iii list at path into out
+func (f *FireflyiiiConnection) getPage(ctx context.Context, path string, query url.Values, page int, out interface{}) error {
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	q.Set("page", strconv.Itoa(page))
+	req, err := f.newRequest(ctx, http.MethodGet, path+"?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := f.cl.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Request to URL %s failed with status code %d", f.FireflyiiiURL+path, resp.StatusCode)
+	}
+	return util.HttpResponseToStruct(resp, out)
+}
+
+// QueueDepth returns number of transactions waiting and being created
+func (f *FireflyiiiConnection) QueueDepth() int {
+	return len(f.FireflyiiiTransactionChan) + int(f.inFlight.Load())
+}
+
+// Check reports whether firefly-iii is reachable and the token is valid
+func (f *FireflyiiiConnection) Check(ctx context.Context) error {
+	req, err := f.newRequest(ctx, http.MethodGet, fireflyiiiAboutUserPath, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := f.cl.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return ErrUnauthorized
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Request to URL %s failed with status code %d", f.FireflyiiiURL+fireflyiiiAboutUserPath, resp.StatusCode)
+	}
+	return nil
+}
+
 func (f *FireflyiiiConnection) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
 	req, err := http.NewRequestWithContext(ctx, method, f.FireflyiiiURL+path, body)
 	if err != nil {
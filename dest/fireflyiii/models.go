@@ -55,6 +55,7 @@ type transactionSplitStore struct {
 	ForeignCurrencyID   string `json:"foreign_currency_id,omitempty"`
 	ForeignCurrencyCode string `json:"foreign_currency_code,omitempty"`
 	BudgetID            string `json:"budget_id,omitempty"`
+	BudgetName          string `json:"budget_name,omitempty"`
 	CategoryID          string `json:"category_id,omitempty"`
 	SourceID            string `json:"source_id,omitempty"`
 	DestinationID       string `json:"destination_id,omitempty"`
@@ -87,21 +88,62 @@ func transactionDTOToTransaction(trans *dto.TransactionDTO) *transaction {
 	tr.Transactions[0].Date = trans.Transaction.Time
 	tr.Transactions[0].Amount = fmt.Sprint(math.Abs(float64(trans.Transaction.Amount)) / 100)
 	tr.Transactions[0].Description = trans.Transaction.Description
+	if foreignCode, _ := iso4217.ByCode(int(trans.Transaction.ForeignCurrencyCode)); foreignCode != "" &&
+		foreignCode != currencyCode && trans.Transaction.ForeignAmount != 0 {
+		tr.Transactions[0].ForeignCurrencyCode = foreignCode
+		tr.Transactions[0].ForeignAmount = fmt.Sprint(math.Abs(float64(trans.Transaction.ForeignAmount)) / 100)
+	}
 	tr.Transactions[0].ExternalID = "AccountId: " + trans.AccountID
 	tr.Transactions[0].Tags = append(tr.Transactions[0].Tags, fbsTag)
+	tr.Transactions[0].Tags = append(tr.Transactions[0].Tags, trans.Tags...)
+	tr.Transactions[0].CategoryName = trans.Category
+	tr.Transactions[0].BudgetName = trans.Budget
 
 	tr.Transactions[0].Notes = fmt.Sprintln(tr.Transactions[0].Notes+"MCC:", trans.Transaction.MCC)
 	tr.Transactions[0].Notes = fmt.Sprintln(tr.Transactions[0].Notes+"Comment:", trans.Transaction.Comment)
 	tr.Transactions[0].Notes = fmt.Sprintln(tr.Transactions[0].Notes+"Description:", trans.Transaction.Description)
 	tr.Transactions[0].Notes = fmt.Sprintln(tr.Transactions[0].Notes+"Counter IBAN:", trans.Transaction.CounterIban)
 	tr.Transactions[0].Notes = fmt.Sprintln(tr.Transactions[0].Notes+"Counter name:", trans.Transaction.CounterName)
+	if trans.Transaction.CounterEdrpou != "" {
+		tr.Transactions[0].Notes = fmt.Sprintln(tr.Transactions[0].Notes+"Counter EDRPOU:", trans.Transaction.CounterEdrpou)
+	}
 	tr.Transactions[0].Notes = fmt.Sprintln(tr.Transactions[0].Notes+"Currency code:", currencyCode)
 	return tr
 }
 
+// split replaces the only split with splits of trans, they share accounts
+// and the rest of fields. Transaction description becomes the group title
+func (tr *transaction) split(trans *dto.TransactionDTO) {
+	if len(trans.Splits) == 0 {
+		return
+	}
+	base := tr.Transactions[0]
+	// Foreign amount can not be divided between splits precisely
+	base.ForeignAmount, base.ForeignCurrencyCode = "", ""
+	tr.GroupTitle = base.Description
+	tr.Transactions = []transactionSplitStore{}
+	for _, v := range trans.Splits {
+		s := base
+		s.Tags = append([]string{}, base.Tags...)
+		s.Amount = fmt.Sprint(float64(v.Amount) / 100)
+		if v.Description != "" {
+			s.Description = v.Description
+		}
+		if v.Category != "" {
+			s.CategoryName = v.Category
+		}
+		if v.Budget != "" {
+			s.BudgetName = v.Budget
+		}
+		tr.Transactions = append(tr.Transactions, s)
+	}
+}
+
+// newTransaction returns transaction rejected by firefly-iii if one with the same
+// hash exists, so transactions sent again after restart or by backfill are not duplicated
 func newTransaction() *transaction {
 	return &transaction{
-		ErrorIfDuplicateHash: false,
+		ErrorIfDuplicateHash: true,
 		ApplyRules:           true,
 		FireWebhooks:         true,
 		Transactions:         []transactionSplitStore{{}},
@@ -113,11 +155,86 @@ type accounts struct {
 	Data []account `json:"data"`
 }
 type account struct {
+	ID         string       `json:"id"`
 	Attributes accountAttrs `json:"attributes"`
 }
 
 type accountAttrs struct {
 	Name  string `json:"name"`
-	ID    string `json:"id"`
 	Notes string `json:"notes"`
 }
+
+// listMeta is pagination of firefly-iii list responses
+type listMeta struct {
+	Pagination struct {
+		TotalPages int `json:"total_pages"`
+	} `json:"pagination"`
+}
+
+// Getting piggy bank unmarshaling struct
+type piggyBanks struct {
+	Data []piggyBank `json:"data"`
+	Meta listMeta    `json:"meta"`
+}
+
+type piggyBank struct {
+	ID         string         `json:"id"`
+	Attributes piggyBankAttrs `json:"attributes"`
+}
+
+type piggyBankAttrs struct {
+	Name         string `json:"name"`
+	AccountID    string `json:"account_id"`
+	TargetAmount string `json:"target_amount,omitempty"`
+	Notes        string `json:"notes,omitempty"`
+}
+
+// Getting budget unmarshaling struct
+type budgets struct {
+	Data []budget `json:"data"`
+	Meta listMeta `json:"meta"`
+}
+
+type budget struct {
+	ID         string      `json:"id"`
+	Attributes budgetAttrs `json:"attributes"`
+}
+
+type budgetAttrs struct {
+	Name string `json:"name"`
+}
+
+// Getting bill unmarshaling struct
+type bills struct {
+	Data []bill   `json:"data"`
+	Meta listMeta `json:"meta"`
+}
+
+type bill struct {
+	ID         string    `json:"id"`
+	Attributes billAttrs `json:"attributes"`
+}
+
+type billAttrs struct {
+	Name         string `json:"name"`
+	AmountMin    string `json:"amount_min"`
+	AmountMax    string `json:"amount_max"`
+	CurrencyCode string `json:"currency_code"`
+	Active       bool   `json:"active"`
+	Notes        string `json:"notes"`
+	// PayDates - expected payment dates in the requested range
+	PayDates  []string       `json:"pay_dates"`
+	PaidDates []billPaidDate `json:"paid_dates"`
+}
+
+type billPaidDate struct {
+	Date string `json:"date"`
+}
+
+// exchangeRate represents fireflyiii currency exchange rate
+type exchangeRate struct {
+	Date string `json:"date"`
+	Rate string `json:"rate"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
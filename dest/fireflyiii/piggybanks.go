@@ -0,0 +1,105 @@
+package firelfyiii
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+)
+
+// SyncSavingsGoals sets goals as target amounts of piggy banks of the corresponding
+// accounts. Piggy bank named after the goal is created if the account has none.
+// Goals without corresponding account are skipped
+func (f *FireflyiiiConnection) SyncSavingsGoals(ctx context.Context, goals []dto.SavingsGoal) error {
+	banks, err := f.getPiggyBankList(ctx)
+	if err != nil {
+		return err
+	}
+	for _, goal := range goals {
+		accountID, err := f.getCorrespondingAccountID(ctx, goal.AccountID)
+		if errors.Is(err, ErrFBSConfigNotFound) {
+			log.Debug().Msgf("Savings goal %s has no corresponding account, skipping", goal.Name)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		target := fmt.Sprintf("%.2f", float64(goal.Goal)/100)
+
+		var bank *piggyBank
+		for i := range banks.Data {
+			if banks.Data[i].Attributes.AccountID == accountID {
+				bank = &banks.Data[i]
+				break
+			}
+		}
+		if bank == nil {
+			log.Info().Msgf("Creating piggy bank for savings goal %s", goal.Name)
+			err = f.savePiggyBank(ctx, http.MethodPost, fireflyiiiPiggyBanksPath, piggyBankAttrs{
+				Name:         goal.Name,
+				AccountID:    accountID,
+				TargetAmount: target,
+				Notes:        fbsTag,
+			})
+		} else if !sameAmount(bank.Attributes.TargetAmount, target) {
+			log.Info().Msgf("Updating piggy bank %s target amount to %s", bank.Attributes.Name, target)
+			err = f.savePiggyBank(ctx, http.MethodPut, fireflyiiiPiggyBanksPath+"/"+bank.ID, piggyBankAttrs{
+				Name:         bank.Attributes.Name,
+				AccountID:    accountID,
+				TargetAmount: target,
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FireflyiiiConnection) getPiggyBankList(ctx context.Context) (*piggyBanks, error) {
+	banks := piggyBanks{}
+	for page := 1; ; page++ {
+		list := piggyBanks{}
+		if err := f.getPage(ctx, fireflyiiiPiggyBanksPath, nil, page, &list); err != nil {
+			return nil, err
+		}
+		banks.Data = append(banks.Data, list.Data...)
+		if page >= list.Meta.Pagination.TotalPages {
+			return &banks, nil
+		}
+	}
+}
+
+func (f *FireflyiiiConnection) savePiggyBank(ctx context.Context, method, path string, bank piggyBankAttrs) error {
+	body, err := json.Marshal(bank)
+	if err != nil {
+		return err
+	}
+	req, err := f.newRequest(ctx, method, path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp, err := f.cl.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Failed to save piggy bank, status code: %d %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+func sameAmount(a, b string) bool {
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+	return errA == nil && errB == nil && x == y
+}
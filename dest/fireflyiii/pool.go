@@ -0,0 +1,176 @@
+package firelfyiii
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+)
+
+// Serve creates transactions received from FireflyiiiTransactionChan with workers
+// until ctx is done. Transactions of an account are passed to the same worker, so
+// they are created one by one in the order received. Each worker holds up to its
+// share of queue size, Serve waits while the queue of the worker is full and stops
+// reading FireflyiiiTransactionChan, so sources are blocked once it is full too.
+// Transactions being created are waited with Shutdown, ones waiting for workers
+// are not created
+func (f *FireflyiiiConnection) Serve(ctx context.Context) {
+	size := f.queueSize / f.workers
+	if size < 1 {
+		size = 1
+	}
+	queues := make([]*workerQueue, f.workers)
+	for i := range queues {
+		queues[i] = newWorkerQueue(size)
+		f.writes.Add(1)
+		go f.work(queues[i])
+	}
+	defer func() {
+		for _, q := range queues {
+			q.close()
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Firefly-iii connection stopped receiving transactions")
+			return
+		case trans := <-f.FireflyiiiTransactionChan:
+			log.Debug().Msgf("ffi Transaction %s received", trans.Transaction.ID)
+			f.inFlight.Add(1)
+			if !queues[workerOf(trans.AccountID, len(queues))].push(ctx, trans) {
+				f.inFlight.Add(-1)
+				log.Info().Msg("Firefly-iii connection stopped receiving transactions")
+				return
+			}
+		}
+	}
+}
+
+// work creates transactions of queue until it is closed. Transactions left in closed
+// queue and ones interrupted are left as is, to be created on the next start
+func (f *FireflyiiiConnection) work(queue *workerQueue) {
+	defer f.writes.Done()
+	for {
+		trans, ok := queue.pop()
+		if !ok {
+			f.inFlight.Add(-int64(queue.drop()))
+			return
+		}
+		if f.writesCtx.Err() == nil {
+			if err := f.Create(f.writesCtx, trans); err != nil {
+				log.Warn().Err(err).Msgf("Failed to create transaction with id: %s", trans.Transaction.ID)
+			}
+		}
+		f.inFlight.Add(-1)
+	}
+}
+
+// workerQueue - up to size transactions waiting for a worker
+type workerQueue struct {
+	mu     sync.Mutex
+	items  []*dto.TransactionDTO
+	size   int
+	closed bool
+	ready  chan struct{}
+	// space is signaled when a transaction is taken from queue
+	space chan struct{}
+}
+
+func newWorkerQueue(size int) *workerQueue {
+	return &workerQueue{size: size, ready: make(chan struct{}, 1), space: make(chan struct{}, 1)}
+}
+
+// push waits for room in queue until ctx is done. Returns false if trans is not queued
+func (q *workerQueue) push(ctx context.Context, trans *dto.TransactionDTO) bool {
+	for {
+		q.mu.Lock()
+		if len(q.items) < q.size {
+			q.items = append(q.items, trans)
+			q.mu.Unlock()
+			signal(q.ready)
+			return true
+		}
+		q.mu.Unlock()
+		select {
+		case <-q.space:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// pop waits for the next transaction, returns false when queue is closed
+func (q *workerQueue) pop() (*dto.TransactionDTO, bool) {
+	for {
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return nil, false
+		}
+		if len(q.items) != 0 {
+			trans := q.items[0]
+			q.items = q.items[1:]
+			q.mu.Unlock()
+			signal(q.space)
+			return trans, true
+		}
+		q.mu.Unlock()
+		<-q.ready
+	}
+}
+
+func (q *workerQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	signal(q.ready)
+}
+
+// drop empties queue returning number of transactions dropped
+func (q *workerQueue) drop() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := len(q.items)
+	q.items = nil
+	return n
+}
+
+// signal wakes up the waiter of c, if any, without blocking
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// workerOf returns worker of account transactions
+func workerOf(accountID string, workers int) int {
+	h := fnv.New32a()
+	h.Write([]byte(accountID))
+	return int(h.Sum32() % uint32(workers))
+}
+
+// Shutdown waits for transactions passed to workers by Serve until ctx is done, then
+// interrupts them. Interrupted transactions are reported to recorder as pending.
+// Must be called after Serve returned
+func (f *FireflyiiiConnection) Shutdown(ctx context.Context) error {
+	defer f.writesCancel()
+	done := make(chan struct{})
+	go func() {
+		f.writes.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Warn().Msgf("Interrupting %d transactions being created", f.inFlight.Load())
+		f.writesCancel()
+		<-done
+		return ctx.Err()
+	}
+	log.Info().Msg("Shutting down firefly-iii connection. Bye!!!")
+	return nil
+}
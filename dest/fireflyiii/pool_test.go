@@ -0,0 +1,162 @@
+package firelfyiii
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+)
+
+type nopRecorder struct{}
+
+func (nopRecorder) Payload(id string, payload []byte)   {}
+func (nopRecorder) Finish(id, status string, err error) {}
+
+// fakeFirefly serves accounts acc1 and acc2 and records descriptions of created transactions.
+// Other paths are served by handlers
+type fakeFirefly struct {
+	*httptest.Server
+	handlers map[string]http.HandlerFunc
+
+	mu      sync.Mutex
+	created []string
+	// gate - when set, transaction creation waits for it to be closed
+	gate chan struct{}
+	// reject - when set, transactions are rejected with it as validation error
+	reject string
+}
+
+func newFakeFirefly(t *testing.T) *fakeFirefly {
+	fake := &fakeFirefly{handlers: map[string]http.HandlerFunc{}}
+	fake.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case fireflyiiiAPIPath + fireflyiiiAccountsPath:
+			fmt.Fprint(w, `{"data": [{"id": "1", "attributes": {"name": "Card 1", "notes": "fbs.mono:acc1"}},
+				{"id": "2", "attributes": {"name": "Card 2", "notes": "fbs.mono:acc2"}}]}`)
+		case fireflyiiiAPIPath + fireflyiiiTransactionPath:
+			fake.mu.Lock()
+			gate, reject := fake.gate, fake.reject
+			fake.mu.Unlock()
+			if gate != nil {
+				<-gate
+			}
+			if reject != "" {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				fmt.Fprint(w, reject)
+				return
+			}
+			tr := transaction{}
+			if err := json.NewDecoder(r.Body).Decode(&tr); err != nil {
+				t.Errorf("transaction body: %s", err)
+			}
+			fake.mu.Lock()
+			fake.created = append(fake.created, tr.Transactions[0].Description)
+			fake.mu.Unlock()
+			fmt.Fprint(w, `{}`)
+		default:
+			if h, ok := fake.handlers[r.URL.Path]; ok {
+				h(w, r)
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+func (fake *fakeFirefly) createdList() []string {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	return append([]string{}, fake.created...)
+}
+
+func testTransaction(account, id string) *dto.TransactionDTO {
+	return &dto.TransactionDTO{
+		AccountID:   account,
+		Transaction: dto.TransactionDTOTransaction{ID: id, Description: id, Amount: -100, Time: time.Now()},
+	}
+}
+
+// serve runs Serve of f until the test ends
+func serve(t *testing.T, f *FireflyiiiConnection) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		f.Serve(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		f.Shutdown(context.Background())
+	})
+}
+
+func waitCreated(t *testing.T, fake *fakeFirefly, n int) []string {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if created := fake.createdList(); len(created) >= n {
+			return created
+		}
+	}
+	t.Fatalf("created %d transactions, want %d", len(fake.createdList()), n)
+	return nil
+}
+
+func TestServeKeepsAccountOrder(t *testing.T) {
+	fake := newFakeFirefly(t)
+	f := NewFireflyiiiConnection("token", fake.URL, 4, 10, nopRecorder{})
+	serve(t, f)
+
+	want := map[string][]string{}
+	for i := 0; i < 20; i++ {
+		account := []string{"acc1", "acc2"}[i%2]
+		id := fmt.Sprintf("%s-%d", account, i)
+		want[account] = append(want[account], id)
+		f.FireflyiiiTransactionChan <- testTransaction(account, id)
+	}
+	got := map[string][]string{}
+	for _, id := range waitCreated(t, fake, 20) {
+		account := id[:4]
+		got[account] = append(got[account], id)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("created %v, want %v", got, want)
+	}
+}
+
+func TestServeBlocksWhenQueueIsFull(t *testing.T) {
+	fake := newFakeFirefly(t)
+	gate := make(chan struct{})
+	fake.gate = gate
+	f := NewFireflyiiiConnection("token", fake.URL, 1, 2, nopRecorder{})
+	serve(t, f)
+
+	// One transaction is being created, two wait for the worker, one is held by Serve
+	// waiting for room and two wait in the channel
+	sent := 0
+send:
+	for i := 0; i < 10; i++ {
+		select {
+		case f.FireflyiiiTransactionChan <- testTransaction("acc1", fmt.Sprint(i)):
+			sent++
+		case <-time.After(200 * time.Millisecond):
+			break send
+		}
+	}
+	if sent != 6 {
+		t.Errorf("%d transactions are accepted while firefly-iii is blocked, want 6", sent)
+	}
+	if depth := f.QueueDepth(); depth != 6 {
+		t.Errorf("queue depth = %d, want 6", depth)
+	}
+	close(gate)
+	waitCreated(t, fake, sent)
+}
@@ -0,0 +1,98 @@
+package firelfyiii
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/rmg/iso4217"
+	"github.com/rs/zerolog/log"
+	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+)
+
+// SyncExchangeRates stores rates of the currencies (ISO names, all if empty) in
+// firefly-iii exchange rates and keeps them to fill missing foreign amounts.
+// Rates already stored for the same date are not sent again, failed ones are
+// sent on the next sync. Failures of all the pairs are returned
+func (f *FireflyiiiConnection) SyncExchangeRates(ctx context.Context, rates []dto.ExchangeRate, currencies []string) error {
+	allowed := map[string]bool{}
+	for _, v := range currencies {
+		allowed[v] = true
+	}
+	errs := []error{}
+	for _, rate := range rates {
+		from, _ := iso4217.ByCode(int(rate.From))
+		to, _ := iso4217.ByCode(int(rate.To))
+		if from == "" || to == "" || (len(allowed) != 0 && !allowed[from] && !allowed[to]) {
+			continue
+		}
+		key := from + "/" + to
+		f.ratesMu.Lock()
+		f.rates[key] = rate
+		stored, ok := f.ratesStored[key]
+		f.ratesMu.Unlock()
+		date := rate.Date.Format("2006-01-02")
+		if ok && stored.Date.Format("2006-01-02") == date && stored.Rate == rate.Rate {
+			continue
+		}
+
+		log.Debug().Msgf("Storing exchange rate %s %f for %s", key, rate.Rate, date)
+		if err := f.storeExchangeRate(ctx, exchangeRate{
+			Date: date,
+			Rate: strconv.FormatFloat(rate.Rate, 'f', -1, 64),
+			From: from,
+			To:   to,
+		}); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			continue
+		}
+		f.ratesMu.Lock()
+		f.ratesStored[key] = rate
+		f.ratesMu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+func (f *FireflyiiiConnection) storeExchangeRate(ctx context.Context, rate exchangeRate) error {
+	body, err := json.Marshal(rate)
+	if err != nil {
+		return err
+	}
+	req, err := f.newRequest(ctx, http.MethodPost, fireflyiiiExchangeRatesPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp, err := f.cl.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Failed to store exchange rate, status code: %d %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+// fillForeignAmount calculates missing foreign amount with the synced rates
+func (f *FireflyiiiConnection) fillForeignAmount(trans *dto.TransactionDTO) {
+	t := &trans.Transaction
+	if t.ForeignCurrencyCode == 0 || t.ForeignCurrencyCode == t.CurrencyCode || t.ForeignAmount != 0 {
+		return
+	}
+	from, _ := iso4217.ByCode(int(t.CurrencyCode))
+	to, _ := iso4217.ByCode(int(t.ForeignCurrencyCode))
+	f.ratesMu.Lock()
+	defer f.ratesMu.Unlock()
+	if rate, ok := f.rates[to+"/"+from]; ok {
+		t.ForeignAmount = int64(math.Round(float64(t.Amount) / rate.Rate))
+	} else if rate, ok := f.rates[from+"/"+to]; ok {
+		t.ForeignAmount = int64(math.Round(float64(t.Amount) * rate.Rate))
+	}
+}
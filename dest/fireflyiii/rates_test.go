@@ -0,0 +1,55 @@
+package firelfyiii
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+)
+
+func TestSyncExchangeRatesRetriesFailed(t *testing.T) {
+	fake := newFakeFirefly(t)
+	posted := []string{}
+	failing := map[string]bool{"USD": true}
+	fake.handlers[fireflyiiiAPIPath+fireflyiiiExchangeRatesPath] = func(w http.ResponseWriter, r *http.Request) {
+		rate := exchangeRate{}
+		json.NewDecoder(r.Body).Decode(&rate)
+		posted = append(posted, rate.From)
+		if failing[rate.From] {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+	f := NewFireflyiiiConnection("token", fake.URL, 1, 1, nopRecorder{})
+	date := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	rates := []dto.ExchangeRate{
+		{From: 840, To: 980, Rate: 41.5, Date: date},
+		{From: 978, To: 980, Rate: 48.2, Date: date},
+	}
+
+	if err := f.SyncExchangeRates(context.Background(), rates, nil); err == nil {
+		t.Error("failed pair is not reported")
+	}
+	// Failed pair does not stop the others and its rate is used anyway
+	trans := &dto.TransactionDTO{Transaction: dto.TransactionDTOTransaction{
+		Amount: -4150, CurrencyCode: 980, ForeignCurrencyCode: 840}}
+	f.fillForeignAmount(trans)
+	if trans.Transaction.ForeignAmount != -100 {
+		t.Errorf("foreign amount = %d, want -100", trans.Transaction.ForeignAmount)
+	}
+
+	// Only the failed pair is sent again
+	failing["USD"] = false
+	if err := f.SyncExchangeRates(context.Background(), rates, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SyncExchangeRates(context.Background(), rates, nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"USD", "EUR", "USD"}; !reflect.DeepEqual(posted, want) {
+		t.Errorf("posted %v, want %v", posted, want)
+	}
+}
@@ -1,7 +1,26 @@
 package firelfyiii
 
+import "time"
+
+// destinationName - name of destination in metrics
+const destinationName = "firefly"
+
 var (
-	fireflyiiiAPIPath         string = "/api/v1"
-	fireflyiiiTransactionPath string = "/transactions"
-	fireflyiiiAccountsPath    string = "/accounts"
+	fireflyiiiAPIPath           string = "/api/v1"
+	fireflyiiiTransactionPath   string = "/transactions"
+	fireflyiiiAccountsPath      string = "/accounts"
+	fireflyiiiPiggyBanksPath    string = "/piggy-banks"
+	fireflyiiiBudgetsPath       string = "/budgets"
+	fireflyiiiBillsPath         string = "/bills"
+	fireflyiiiExchangeRatesPath string = "/exchange-rates"
+	fireflyiiiAboutUserPath     string = "/about/user"
 )
+
+// budgetsCacheTTL - budgets are fetched again when cached ones are older than that
+const budgetsCacheTTL = 5 * time.Minute
+
+// billsCacheTTL - active bills are fetched again when cached ones are older
+const billsCacheTTL = 5 * time.Minute
+
+// billMatchPrefix - prefix of bill notes lines with patterns of payee or description
+const billMatchPrefix = "fbs.match:"
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+	"github.com/sudores/firefly-iii-bank-sync/journal"
+	"github.com/sudores/firefly-iii-bank-sync/metrics"
+	"github.com/sudores/firefly-iii-bank-sync/payee"
+	"github.com/sudores/firefly-iii-bank-sync/rules"
+	"github.com/sudores/firefly-iii-bank-sync/tracing"
+)
+
+// forwarder records transactions from sources in journal and passes queued ones
+// to destination channel. Sources wait for the record only, so they are not held
+// by destination. Transactions not passed on before stop are left pending in
+// journal and passed on after the next start
+type forwarder struct {
+	jr    *journal.Journal
+	rules *rules.Engine
+	// payees is nil when payee accounts are disabled
+	payees *payee.Normalizer
+	dst    chan<- *dto.TransactionDTO
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newForwarder(jr *journal.Journal, rules *rules.Engine, payees *payee.Normalizer,
+	dst chan<- *dto.TransactionDTO) *forwarder {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &forwarder{jr: jr, rules: rules, payees: payees, dst: dst, ctx: ctx, cancel: cancel}
+}
+
+// forward records transactions of source until src is closed or forwarder is stopped.
+// Payee is normalized and rules are applied first, dropped transactions are not
+// recorded. Trace is started here for sources that do not start it themselves
+func (f *forwarder) forward(source string, src <-chan *dto.TransactionDTO) {
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		for {
+			select {
+			case v, ok := <-src:
+				if !ok {
+					return
+				}
+				f.record(source, v)
+			case <-f.ctx.Done():
+				f.drain(source, src)
+				return
+			}
+		}
+	}()
+}
+
+// drain records transactions already sent by stopped source
+func (f *forwarder) drain(source string, src <-chan *dto.TransactionDTO) {
+	for {
+		select {
+		case v, ok := <-src:
+			if !ok {
+				return
+			}
+			f.record(source, v)
+		default:
+			return
+		}
+	}
+}
+
+// record applies rules to transaction, normalizes its payee and queues it in journal.
+// Transaction is acknowledged to source once the record is persisted
+func (f *forwarder) record(source string, v *dto.TransactionDTO) {
+	metrics.TransactionsReceived.WithLabelValues(source, v.AccountID).Inc()
+	enqueued := v.Enqueued
+	if enqueued == nil {
+		enqueued = func(err error) {}
+	}
+	v.Enqueued = nil
+	if res := f.rules.Apply(source, v); res.Drop {
+		log.Info().Msgf("Transaction %s is dropped by rule %q", v.Transaction.ID, res.Rules[len(res.Rules)-1])
+		enqueued(nil)
+		return
+	}
+	// Payee is normalized after rules, so it follows payee of rules and keeps their counter account
+	if f.payees != nil {
+		f.payees.Apply(v)
+	}
+	if v.Trace == nil {
+		_, span := tracing.StartTransaction(context.Background(), source, v)
+		span.End()
+	}
+	if !f.jr.Receive(source, v, enqueued) {
+		log.Info().Msgf("Transaction %s is skipped or already created", v.Transaction.ID)
+		enqueued(nil)
+	}
+}
+
+// dispatch passes transactions queued in journal on in the order queued until
+// forwarder is stopped, starting with ones left pending before restart
+func (f *forwarder) dispatch() {
+	if n := f.jr.Count(journal.StatusPending); n != 0 {
+		log.Info().Msgf("Resubmitting %d transactions left pending before restart", n)
+	}
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		for {
+			for _, v := range f.jr.Dequeue() {
+				if !f.send(v) {
+					return
+				}
+			}
+			select {
+			case <-f.jr.Ready():
+			case <-f.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// send passes transaction on unless forwarder is stopped
+func (f *forwarder) send(v *dto.TransactionDTO) bool {
+	_, span := tracing.Start(context.Background(), v, "forward")
+	defer span.End()
+	select {
+	case f.dst <- v:
+		log.Debug().Msgf("Transaction %s is passed on", v.Transaction.ID)
+		return true
+	case <-f.ctx.Done():
+		log.Info().Msgf("Transaction %s is left pending till the next start", v.Transaction.ID)
+		return false
+	}
+}
+
+// stop makes sources forwarding to drain their channels into journal, stops
+// dispatching and waits for them. Sources must be stopped before
+func (f *forwarder) stop() {
+	f.cancel()
+	f.wg.Wait()
+}
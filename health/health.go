@@ -0,0 +1,163 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// CheckFunc reports component status. Returned detail is informational
+type CheckFunc func(ctx context.Context) (detail string, err error)
+
+// Health keeps component checks and serves liveness and readiness endpoints.
+// Liveness checks are run by both endpoints, readiness ones by /readyz only
+type Health struct {
+	mu        sync.Mutex
+	liveness  []check
+	readiness []check
+	queues    []queue
+}
+
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+type queue struct {
+	name  string
+	depth func() int
+}
+
+// ComponentStatus is a single check result
+type ComponentStatus struct {
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// QueueDepth - number of transactions waiting in component, nil if it has no queue
+	QueueDepth *int `json:"queue_depth,omitempty"`
+}
+
+// Report is a response of health endpoints
+type Report struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+func New() *Health {
+	return &Health{}
+}
+
+// AddLiveness adds check of the app being alive, e.g. it is serving requests
+func (h *Health) AddLiveness(name string, fn CheckFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.liveness = append(h.liveness, check{name: name, fn: fn})
+}
+
+// AddReadiness adds check of the app being able to sync transactions
+func (h *Health) AddReadiness(name string, fn CheckFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.readiness = append(h.readiness, check{name: name, fn: fn})
+}
+
+// AddQueue adds depth of component queue to reports of both endpoints
+func (h *Health) AddQueue(name string, depth func() int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.queues = append(h.queues, queue{name: name, depth: depth})
+}
+
+// Register sets /healthz and /readyz handlers on http.DefaultServeMux
+func (h *Health) Register() {
+	h.register(http.DefaultServeMux)
+}
+
+// Handler returns handler serving /healthz and /readyz only
+func (h *Health) Handler() http.Handler {
+	mux := http.NewServeMux()
+	h.register(mux)
+	return mux
+}
+
+func (h *Health) register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		h.serve(w, r, false)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		h.serve(w, r, true)
+	})
+}
+
+// Check runs liveness checks and readiness ones if readiness is set
+func (h *Health) Check(ctx context.Context, readiness bool) Report {
+	h.mu.Lock()
+	checks := append([]check{}, h.liveness...)
+	if readiness {
+		checks = append(checks, h.readiness...)
+	}
+	queues := append([]queue{}, h.queues...)
+	h.mu.Unlock()
+
+	report := Report{Status: StatusOK, Components: map[string]ComponentStatus{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c check) {
+			defer wg.Done()
+			detail, err := c.fn(ctx)
+			status := ComponentStatus{Status: StatusOK, Detail: detail}
+			if err != nil {
+				status.Status = StatusFail
+				status.Error = err.Error()
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				report.Status = StatusFail
+			}
+			report.Components[c.name] = status
+		}(c)
+	}
+	wg.Wait()
+	for _, q := range queues {
+		status, ok := report.Components[q.name]
+		if !ok {
+			status.Status = StatusOK
+		}
+		depth := q.depth()
+		status.QueueDepth = &depth
+		report.Components[q.name] = status
+	}
+	return report
+}
+
+// serve responds with statuses and queue depths of components. Endpoints are public,
+// so details and errors, which may reveal paths and hosts, are logged instead
+func (h *Health) serve(w http.ResponseWriter, r *http.Request, readiness bool) {
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+	report := h.Check(ctx, readiness)
+	for name, c := range report.Components {
+		if c.Status != StatusOK {
+			log.Warn().Msgf("Health check of %s failed: %s", name, c.Error)
+		}
+		report.Components[name] = ComponentStatus{Status: c.Status, QueueDepth: c.QueueDepth}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status != StatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Warn().Err(err).Msg("Failed to write health report")
+	}
+}
@@ -0,0 +1,58 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	h := New()
+	h.AddLiveness("listener", func(ctx context.Context) (string, error) {
+		return "serving on :3000", nil
+	})
+	h.AddReadiness("firefly", func(ctx context.Context) (string, error) {
+		return "", errors.New("Request to URL http://firefly.internal failed")
+	})
+	h.AddQueue("firefly", func() int { return 3 })
+	h.AddQueue("monobank", func() int { return 1 })
+	srv := httptest.NewServer(h.Handler())
+	defer srv.Close()
+
+	get := func(path string) (int, Report) {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		report := Report{}
+		if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, report
+	}
+
+	code, report := get("/healthz")
+	if code != http.StatusOK || report.Status != StatusOK || len(report.Components) != 3 {
+		t.Errorf("/healthz = %d %+v", code, report)
+	}
+	if c := report.Components["monobank"]; c.Status != StatusOK || c.QueueDepth == nil || *c.QueueDepth != 1 {
+		t.Errorf("monobank = %+v", c)
+	}
+
+	code, report = get("/readyz")
+	c := report.Components["firefly"]
+	if code != http.StatusServiceUnavailable || report.Status != StatusFail || c.Status != StatusFail ||
+		c.QueueDepth == nil || *c.QueueDepth != 3 {
+		t.Errorf("/readyz = %d %+v", code, report)
+	}
+	// Details and errors are not public
+	for name, c := range report.Components {
+		if c.Detail != "" || c.Error != "" {
+			t.Errorf("%s reveals %q %q", name, c.Detail, c.Error)
+		}
+	}
+}
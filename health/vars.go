@@ -0,0 +1,6 @@
+package health
+
+import "time"
+
+// checkTimeout - max time of running all checks of a request
+const checkTimeout = time.Second * 5
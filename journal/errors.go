@@ -0,0 +1,8 @@
+package journal
+
+import "errors"
+
+var (
+	ErrNotFound       = errors.New("Transaction not found in journal")
+	ErrAlreadyCreated = errors.New("Transaction is already created")
+)
@@ -0,0 +1,337 @@
+package journal
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+	"github.com/sudores/firefly-iii-bank-sync/store"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusCreated   = "created"
+	StatusDuplicate = "duplicate"
+	StatusFailed    = "failed"
+	StatusSkipped   = "skipped"
+	// StatusDryRun - transaction was rendered in dry run, not created
+	StatusDryRun = "dry-run"
+)
+
+// Record is a transaction passing the pipeline with the result of its creation
+type Record struct {
+	ID       string `json:"id"`
+	Source   string `json:"source"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Attempts int    `json:"attempts"`
+	// Payload - request body sent to destination on the last attempt
+	Payload     json.RawMessage     `json:"payload,omitempty"`
+	Transaction *dto.TransactionDTO `json:"transaction"`
+	ReceivedAt  time.Time           `json:"received_at"`
+	UpdatedAt   time.Time           `json:"updated_at"`
+}
+
+// Journal keeps records of recent transactions persisted in store. Changes are
+// saved in background, changes made while the store is written are saved together
+type Journal struct {
+	st    *store.Store
+	limit int
+
+	mu      sync.Mutex
+	records map[string]*Record
+	// queue - ids of pending records to be passed on, oldest first
+	queue  []string
+	queued map[string]bool
+	ready  chan struct{}
+
+	// dirty - records are changed since the last save started
+	dirty  bool
+	saving bool
+	// waiters are called with result of the save including their changes
+	waiters []func(err error)
+}
+
+// New loads journal from store. Only limit of the most recent records is kept.
+// Records left pending are queued to be passed on again
+func New(st *store.Store, limit int) (*Journal, error) {
+	j := &Journal{st: st, limit: limit, records: map[string]*Record{}, queued: map[string]bool{}, ready: make(chan struct{}, 1)}
+	if _, err := st.Get(journalKey, &j.records); err != nil {
+		return nil, err
+	}
+	records := j.sorted()
+	for i := len(records) - 1; i >= 0; i-- {
+		if r := records[i]; r.Status == StatusPending && r.Transaction != nil {
+			j.enqueue(r.ID)
+		}
+	}
+	return j, nil
+}
+
+// Received records transaction received from source as pending and waits for the
+// record to be persisted. Returns false for skipped and already created transactions,
+// they must not be passed on. Error is returned when the record is not persisted
+func (j *Journal) Received(source string, trans *dto.TransactionDTO) (bool, error) {
+	done := make(chan error, 1)
+	if !j.Receive(source, trans, func(err error) { done <- err }) {
+		return false, nil
+	}
+	return true, <-done
+}
+
+// Receive records transaction received from source as pending and queues it without
+// waiting for it to be persisted, done is called after. Returns false for skipped and
+// already created transactions, done is not called for them
+func (j *Journal) Receive(source string, trans *dto.TransactionDTO, done func(err error)) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	r, ok := j.records[trans.Transaction.ID]
+	if ok && (r.Status == StatusSkipped || r.Status == StatusCreated || r.Status == StatusDuplicate) {
+		return false
+	}
+	if !ok {
+		r = &Record{ID: trans.Transaction.ID, ReceivedAt: time.Now()}
+		j.records[r.ID] = r
+	}
+	// Copy as transaction is modified further down the pipeline
+	t := *trans
+	r.Source = source
+	r.Transaction = &t
+	r.Status = StatusPending
+	r.Error = ""
+	r.UpdatedAt = time.Now()
+	j.enqueue(r.ID)
+	j.persist(done)
+	return true
+}
+
+// Payload records request body sent to destination
+func (j *Journal) Payload(id string, payload []byte) {
+	j.update(id, func(r *Record) {
+		r.Payload = payload
+	})
+}
+
+// Finish records status of transaction creation and error of failed one
+func (j *Journal) Finish(id, status string, err error) {
+	j.update(id, func(r *Record) {
+		r.Attempts++
+		r.Status = status
+		if err != nil && status == StatusFailed {
+			r.Error = err.Error()
+		}
+	})
+}
+
+// Skip marks transaction as skipped, it is not created if received again
+func (j *Journal) Skip(id string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	r, ok := j.records[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if r.Status == StatusCreated {
+		return ErrAlreadyCreated
+	}
+	r.Status = StatusSkipped
+	r.UpdatedAt = time.Now()
+	j.persist(nil)
+	return nil
+}
+
+// Retry queues transaction of failed or skipped record to be passed on again and
+// waits for the record to be persisted
+func (j *Journal) Retry(id string) error {
+	j.mu.Lock()
+	r, ok := j.records[id]
+	switch {
+	case !ok || r.Transaction == nil:
+		j.mu.Unlock()
+		return ErrNotFound
+	case r.Status == StatusCreated || r.Status == StatusDuplicate:
+		j.mu.Unlock()
+		return ErrAlreadyCreated
+	}
+	r.Status = StatusPending
+	r.Error = ""
+	r.UpdatedAt = time.Now()
+	j.enqueue(id)
+	done := make(chan error, 1)
+	j.persist(func(err error) { done <- err })
+	j.mu.Unlock()
+	return <-done
+}
+
+// Dequeue returns transactions of queued records still pending in the order queued
+func (j *Journal) Dequeue() []*dto.TransactionDTO {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	list := []*dto.TransactionDTO{}
+	for _, id := range j.queue {
+		delete(j.queued, id)
+		if r, ok := j.records[id]; ok && r.Status == StatusPending && r.Transaction != nil {
+			t := *r.Transaction
+			list = append(list, &t)
+		}
+	}
+	j.queue = nil
+	return list
+}
+
+// Ready receives when transactions are queued
+func (j *Journal) Ready() <-chan struct{} {
+	return j.ready
+}
+
+// enqueue queues pending record once. Must be called with mu held
+func (j *Journal) enqueue(id string) {
+	if j.queued[id] {
+		return
+	}
+	j.queued[id] = true
+	j.queue = append(j.queue, id)
+	select {
+	case j.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Get returns record by transaction id
+func (j *Journal) Get(id string) (Record, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	r, ok := j.records[id]
+	if !ok {
+		return Record{}, false
+	}
+	return *r, true
+}
+
+// LastReceived returns time the last transaction of source was received, zero if none
+func (j *Journal) LastReceived(source string) time.Time {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	last := time.Time{}
+	for _, r := range j.records {
+		if r.Source == source && r.ReceivedAt.After(last) {
+			last = r.ReceivedAt
+		}
+	}
+	return last
+}
+
+// Count returns number of records with status
+func (j *Journal) Count(status string) int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	n := 0
+	for _, r := range j.records {
+		if r.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// List returns up to limit of the most recent records with status, any status if empty
+func (j *Journal) List(status string, limit int) []Record {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	list := []Record{}
+	for _, r := range j.sorted() {
+		if len(list) == limit {
+			break
+		}
+		if status == "" || r.Status == status {
+			list = append(list, *r)
+		}
+	}
+	return list
+}
+
+func (j *Journal) update(id string, fn func(r *Record)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	r, ok := j.records[id]
+	if !ok {
+		return
+	}
+	fn(r)
+	r.UpdatedAt = time.Now()
+	j.persist(nil)
+}
+
+// Flush waits for the changes made to be persisted
+func (j *Journal) Flush() error {
+	done := make(chan error, 1)
+	j.mu.Lock()
+	j.persist(func(err error) { done <- err })
+	j.mu.Unlock()
+	return <-done
+}
+
+// persist schedules save of the changes, done is called with its result. Must be
+// called with mu held
+func (j *Journal) persist(done func(err error)) {
+	j.dirty = true
+	if done != nil {
+		j.waiters = append(j.waiters, done)
+	}
+	if !j.saving {
+		j.saving = true
+		go j.saveLoop()
+	}
+}
+
+// saveLoop saves records until there are no changes left. Records are encoded
+// under mu and written to store without it
+func (j *Journal) saveLoop() {
+	j.mu.Lock()
+	for j.dirty {
+		j.dirty = false
+		j.evict()
+		data, err := json.Marshal(j.records)
+		waiters := j.waiters
+		j.waiters = nil
+		j.mu.Unlock()
+		if err == nil {
+			err = j.st.Set(journalKey, json.RawMessage(data))
+		}
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to persist transactions journal")
+		}
+		for _, done := range waiters {
+			done(err)
+		}
+		j.mu.Lock()
+	}
+	j.saving = false
+	j.mu.Unlock()
+}
+
+// sorted returns records from the most recent one
+func (j *Journal) sorted() []*Record {
+	list := make([]*Record, 0, len(j.records))
+	for _, r := range j.records {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].ReceivedAt.After(list[b].ReceivedAt) })
+	return list
+}
+
+// evict drops records exceeding limit. Pending records are never dropped as they
+// are the queue of transactions to be created
+func (j *Journal) evict() {
+	if len(j.records) <= j.limit {
+		return
+	}
+	for _, r := range j.sorted()[j.limit:] {
+		if r.Status != StatusPending {
+			delete(j.records, r.ID)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+package journal
+
+const journalKey = "journal.records"
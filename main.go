@@ -1,78 +1,89 @@
 package main
 
 import (
-	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
-	"os/signal"
-	"syscall"
-	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
-	"github.com/sudores/firefly-iii-bank-sync/bank/mono"
-	"github.com/sudores/firefly-iii-bank-sync/cnf"
-	firelfyiii "github.com/sudores/firefly-iii-bank-sync/dest/fireflyiii"
 )
 
-func main() {
-
-	// Getting configuration
-	cfg, err := cnf.Parse()
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to initialize logging")
-	}
+const usage = `Usage: app [command] [arguments]
 
-	// Setup logging
-	loggingInit(cfg.LogLevel)
-	log.Info().Msg("Logging setup success")
+Commands:
+  serve                                  run the sync daemon, the default command
+  backfill -account ID -from DATE [-to DATE]
+                                         create monobank transactions of account in the date range
+  import [-format sms|json] FILE         create transactions from file
+  accounts list                          list bank accounts and firefly-iii accounts they are synced to
+  webhook status|register|unregister|rotate
+                                         manage monobank webhook
+  config validate                        check configuration
+  health                                 check the running daemon is alive
+  dry-run backfill|import ...            print firefly-iii payloads backfill or import would send
+  sms test [-templates FILE] [TEXT]      show sms template matching notification text
+  rules test [-rules FILE] [-aliases FILE] [-source NAME] [FILE]
+                                         apply rules to json array of transactions and print the result
 
-	exit := make(chan os.Signal)
-	signal.Notify(exit, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP, syscall.SIGQUIT)
+Configuration is read from environment variables, see README.md.
+Stop the daemon before running commands changing STATE_FILE (backfill, import,
+webhook rotate) or use the admin api.
+`
 
-	ffi := firelfyiii.NewFireflyiiiConnection(cfg.FFIToken, cfg.FFIURL)
-	ffiCtx, ffiCancel := context.WithCancel(context.Background())
-	defer ffiCancel()
-	go func() {
-		log.Info().Msg("Firefly-iii starting serving")
-		ffi.Serve(ffiCtx)
-		log.Fatal().Err(err).Msg("Firefly serve failed")
-	}()
+// command runs subcommand with its arguments
+type command func(args []string) error
 
-	mb := mono.NewMonoConnetion(cfg.MonobankAPIToken, cfg.FBSHost, cfg.ListenAddr)
-	go func() {
-		log.Info().Msg("Monobank starting serving")
-		mb.Serve()
-	}()
-	go func() {
+var commands = map[string]command{
+	"serve":    serve,
+	"backfill": backfillCommand(false),
+	"import":   importCommand(false),
+	"accounts": accountsCommand,
+	"webhook":  webhookCommand,
+	"config":   configCommand,
+	"health":   healthCommand,
+	"dry-run":  dryRunCommand,
+	"sms":      smsCommand,
+	"rules":    rulesCommand,
+}
 
-		for v := range mb.TransactionChan {
-			log.Debug().Msg("main Creating transaction")
-			ffi.FireflyiiiTransactionChan <- v
-			log.Debug().Msg("main Created transaction")
+func main() {
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	// Kept for compatibility with the command used before subcommands
+	if name == "rotate-webhook-path" {
+		name, args = "webhook", []string{"rotate"}
+	}
+	if name == "help" || name == "-h" || name == "--help" {
+		fmt.Print(usage)
+		return
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", name, usage)
+		os.Exit(2)
+	}
+	if err := cmd(args); err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprintf(os.Stderr, "%s\n\n%s", err, usage)
+			os.Exit(2)
 		}
-
-	}()
-
-	osSig := <-exit
-	log.Info().Msgf("%s received. Shutting down...", osSig.String())
-
-	// TODO: Add contexts cancellation
-	mbCtx, mbCancel := context.WithTimeout(context.Background(), time.Second*10)
-	defer mbCancel()
-	if err := mb.Shutdown(mbCtx); err != nil {
-		log.Fatal().Err(err).Msg("Monobank shutdown failed with error")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-
-	log.Info().Msg("Shutdown successful. Bye!!!")
 }
 
-// loggingInit setups the logging of whole bot
-func loggingInit(logLevel string) {
-	log.Logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
+// loggingInit setups the logging of whole bot. Unrecognized level is reported
+// by validateConfig, info level is used till then
+func loggingInit(logLevel string, out io.Writer) {
+	log.Logger = zerolog.New(out).With().Timestamp().Logger()
 
 	level, err := zerolog.ParseLevel(logLevel)
 	if err != nil {
-		log.Fatal().Msgf(`Log level "%s" is unrecognized. Eligible log levels are: trace, debug, info, err, fatal, panic`, logLevel)
+		level = zerolog.InfoLevel
 	}
 	zerolog.SetGlobalLevel(level)
 	log.Debug().Msg("Logger initialized")
@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sudores/firefly-iii-bank-sync/util"
+)
+
+var apiVersionRe = regexp.MustCompile(`^v\d+$`)
+
+var (
+	TransactionsReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transactions_received_total",
+		Help:      "Transactions received from sources",
+	}, []string{"source", "account"})
+
+	TransactionsPushed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transactions_pushed_total",
+		Help:      "Transactions created in destinations",
+	}, []string{"destination", "account"})
+
+	TransactionsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transactions_failed_total",
+		Help:      "Transactions failed to be created in destinations",
+	}, []string{"destination", "account"})
+
+	TransactionsDuplicate = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transactions_duplicate_total",
+		Help:      "Transactions rejected by destinations as duplicates",
+	}, []string{"destination", "account"})
+
+	LastSync = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_sync_timestamp_seconds",
+		Help:      "Time of the last transaction successfully created for account",
+	}, []string{"destination", "account"})
+
+	BillsUnpaid = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bills_unpaid_total",
+		Help:      "Bills expected to be paid and found unpaid at the end of grace period",
+	}, []string{"bill"})
+
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of requests to external services",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"service", "method", "endpoint", "code"})
+)
+
+// Register sets /metrics handler on http.DefaultServeMux
+func Register() {
+	http.Handle("/metrics", promhttp.Handler())
+}
+
+// RegisterQueueDepth exposes depth of component queue returned by fn
+func RegisterQueueDepth(component string, fn func() int) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Name:        "queue_depth",
+		Help:        "Transactions waiting to be processed",
+		ConstLabels: prometheus.Labels{"component": component},
+	}, func() float64 { return float64(fn()) })
+}
+
+// ObservePush counts result of creating transaction of account in destination
+func ObservePush(destination, account string, err error, duplicate bool) {
+	switch {
+	case duplicate:
+		TransactionsDuplicate.WithLabelValues(destination, account).Inc()
+	case err != nil:
+		TransactionsFailed.WithLabelValues(destination, account).Inc()
+	default:
+		TransactionsPushed.WithLabelValues(destination, account).Inc()
+		LastSync.WithLabelValues(destination, account).SetToCurrentTime()
+	}
+}
+
+// InstrumentClient makes client to observe requests duration to service
+func InstrumentClient(service string, cl *http.Client) *http.Client {
+	next := cl.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	cl.Transport = util.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		start := time.Now()
+		resp, err := next.RoundTrip(req)
+		code := "error"
+		if err == nil {
+			code = strconv.Itoa(resp.StatusCode)
+		}
+		requestDuration.WithLabelValues(service, req.Method, endpointLabel(req.URL.Path), code).
+			Observe(time.Since(start).Seconds())
+		return resp, err
+	})
+	return cl
+}
+
+// endpointLabel cuts path at the first segment with digits (ids, timestamps),
+// except api version, to keep labels cardinality low
+func endpointLabel(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, v := range segments {
+		if strings.IndexFunc(v, unicode.IsDigit) != -1 && !apiVersionRe.MatchString(v) {
+			segments = segments[:i]
+			break
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
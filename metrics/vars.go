@@ -0,0 +1,3 @@
+package metrics
+
+const namespace = "fbs"
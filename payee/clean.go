@@ -0,0 +1,70 @@
+package payee
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// cardMask matches masked card numbers, e.g. 5375****1234 or *1234
+var cardMask = regexp.MustCompile(`\d*\*+\d+`)
+
+// Clean removes noise from raw payee name: card masks, store numbers, legal forms,
+// cities and quotes. Names in upper case are converted to title case.
+// E.g. "SILPO 123 KYIV" becomes "Silpo"
+func Clean(raw string) string {
+	s := cardMask.ReplaceAllString(raw, " ")
+	s = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`"'«»“”„`, r) {
+			return -1
+		}
+		if unicode.IsSpace(r) || r == ',' || r == '/' {
+			return ' '
+		}
+		return r
+	}, s)
+	words := []string{}
+	for _, w := range strings.Fields(s) {
+		w = strings.Trim(w, ".-_#*")
+		if w == "" || isNumber(w) || noiseWords[strings.ToUpper(w)] {
+			continue
+		}
+		words = append(words, w)
+	}
+	if len(words) == 0 {
+		return strings.TrimSpace(raw)
+	}
+	name := strings.Join(words, " ")
+	if name == strings.ToUpper(name) {
+		name = titleCase(name)
+	}
+	return name
+}
+
+// isNumber reports whether word is mostly digits, e.g. store number or terminal
+// id like "A123". Names with digits like "7-ELEVEN" are kept
+func isNumber(s string) bool {
+	letters, digits := 0, 0
+	for _, r := range s {
+		switch {
+		case unicode.IsLetter(r):
+			letters++
+		case unicode.IsDigit(r):
+			digits++
+		}
+	}
+	return digits >= letters
+}
+
+// titleCase capitalizes the first letter of every word and its parts, e.g. ATB-MARKET
+func titleCase(s string) string {
+	prev := ' '
+	return strings.Map(func(r rune) rune {
+		upper := !unicode.IsLetter(prev) && !unicode.IsDigit(prev)
+		prev = r
+		if upper {
+			return unicode.ToUpper(r)
+		}
+		return unicode.ToLower(r)
+	}, s)
+}
@@ -0,0 +1,70 @@
+package payee
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// Alias gives one name to the different spellings of a payee
+type Alias struct {
+	Name string `json:"name"`
+	// Patterns - regular expressions matched against raw and cleaned payee name
+	Patterns []string `json:"patterns"`
+	// Iban, Edrpou - counterparty keys, matched before patterns
+	Iban   []string `json:"iban"`
+	Edrpou []string `json:"edrpou"`
+
+	patterns []*regexp.Regexp
+}
+
+// LoadAliases reads aliases from json file with an array of Alias objects and
+// compiles them. No aliases are returned for empty path
+func LoadAliases(path string) ([]Alias, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	aliases := []Alias{}
+	if err := json.Unmarshal(data, &aliases); err != nil {
+		return nil, err
+	}
+	for i := range aliases {
+		for _, p := range aliases[i].Patterns {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to compile payee alias %q: %w", aliases[i].Name, err)
+			}
+			aliases[i].patterns = append(aliases[i].patterns, re)
+		}
+	}
+	return aliases, nil
+}
+
+func (a *Alias) matchKey(iban, edrpou string) bool {
+	return (iban != "" && contains(a.Iban, iban)) || (edrpou != "" && contains(a.Edrpou, edrpou))
+}
+
+func (a *Alias) matchName(names ...string) bool {
+	for _, re := range a.patterns {
+		for _, name := range names {
+			if name != "" && re.MatchString(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package payee
+
+import (
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+	"github.com/sudores/firefly-iii-bank-sync/store"
+)
+
+// Normalizer names counterparties of transactions, so destinations book them to
+// the same expense or revenue account whatever spelling bank uses
+type Normalizer struct {
+	mu      sync.RWMutex
+	aliases []Alias
+
+	// st keeps names by counterparty key, nil when keys are not used
+	st *store.Store
+	// saveMu keeps snapshots of names written in the order they are taken
+	saveMu  sync.Mutex
+	namesMu sync.Mutex
+	names   map[string]string
+	// dirty - names are changed since the last save, saving - saveLoop is running
+	dirty  bool
+	saving bool
+	// readOnly - names of new keys are not persisted
+	readOnly bool
+}
+
+// New builds normalizer of compiled aliases. When st is set the first name of a
+// counterparty with edrpou or iban is persisted and used for its later transactions
+func New(aliases []Alias, st *store.Store) (*Normalizer, error) {
+	n := &Normalizer{aliases: aliases, st: st, names: map[string]string{}}
+	if st != nil {
+		if _, err := st.Get(namesKey, &n.names); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// SetReadOnly stops persisting names of new counterparty keys, persisted names are used still
+func (n *Normalizer) SetReadOnly() {
+	n.namesMu.Lock()
+	defer n.namesMu.Unlock()
+	n.readOnly = true
+}
+
+// SetAliases replaces aliases of normalizer with compiled aliases
+func (n *Normalizer) SetAliases(aliases []Alias) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.aliases = aliases
+}
+
+// Apply sets counter account of transaction to the normalized payee name.
+// Counter account already set is kept
+func (n *Normalizer) Apply(trans *dto.TransactionDTO) {
+	if trans.CounterAccount != "" {
+		return
+	}
+	trans.CounterAccount = n.Name(trans)
+}
+
+// Name returns normalized payee name of transaction: alias matched by counterparty
+// key, alias matched by name, name persisted for the key or cleaned counter name
+// (description if empty). Aliases take precedence over persisted names, so they
+// apply to counterparties seen before they are added
+func (n *Normalizer) Name(trans *dto.TransactionDTO) string {
+	t := trans.Transaction
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	for i := range n.aliases {
+		if n.aliases[i].matchKey(t.CounterIban, t.CounterEdrpou) {
+			return n.aliases[i].Name
+		}
+	}
+	raw := t.CounterName
+	if raw == "" {
+		raw = t.Description
+	}
+	cleaned := Clean(raw)
+	for i := range n.aliases {
+		if n.aliases[i].matchName(raw, cleaned) {
+			return n.aliases[i].Name
+		}
+	}
+
+	key := t.CounterEdrpou
+	if key == "" {
+		key = t.CounterIban
+	}
+	if name := n.keyName(key); name != "" {
+		return name
+	}
+	n.setKeyName(key, cleaned)
+	return cleaned
+}
+
+func (n *Normalizer) keyName(key string) string {
+	if n.st == nil || key == "" {
+		return ""
+	}
+	n.namesMu.Lock()
+	defer n.namesMu.Unlock()
+	return n.names[key]
+}
+
+// setKeyName remembers name of key. Names are persisted in background, so
+// transactions do not wait for store
+func (n *Normalizer) setKeyName(key, name string) {
+	if n.st == nil || key == "" || name == "" {
+		return
+	}
+	n.namesMu.Lock()
+	defer n.namesMu.Unlock()
+	n.names[key] = name
+	if n.readOnly {
+		return
+	}
+	n.dirty = true
+	if !n.saving {
+		n.saving = true
+		go n.saveLoop()
+	}
+}
+
+// saveLoop persists names until there are no changes left or save fails
+func (n *Normalizer) saveLoop() {
+	for {
+		err := n.Flush()
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to persist payee names")
+		}
+		n.namesMu.Lock()
+		if err != nil || !n.dirty {
+			n.saving = false
+			n.namesMu.Unlock()
+			return
+		}
+		n.namesMu.Unlock()
+	}
+}
+
+// Flush persists names changed since the last save. Names are written to store
+// outside of the lock of names
+func (n *Normalizer) Flush() error {
+	n.saveMu.Lock()
+	defer n.saveMu.Unlock()
+	n.namesMu.Lock()
+	if !n.dirty {
+		n.namesMu.Unlock()
+		return nil
+	}
+	n.dirty = false
+	names := make(map[string]string, len(n.names))
+	for k, v := range n.names {
+		names[k] = v
+	}
+	n.namesMu.Unlock()
+	if err := n.st.Set(namesKey, names); err != nil {
+		n.namesMu.Lock()
+		n.dirty = true
+		n.namesMu.Unlock()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package payee
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+	"github.com/sudores/firefly-iii-bank-sync/store"
+)
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"SILPO 123 KYIV", "Silpo"},
+		{"7-ELEVEN 1234", "7-Eleven"},
+		{`ТОВ "Сільпо-Фуд"`, "Сільпо-Фуд"},
+		{"ATB-MARKET #A123 LVIV UA", "Atb-Market"},
+		{"Card 5375****1234 Nova Poshta", "Card Nova Poshta"},
+		{"*1234 WOG, Odesa/UKR", "Wog"},
+		{"McDonald's", "McDonalds"},
+		{"Rozetka.ua", "Rozetka.ua"},
+		{"4PLAY", "4play"},
+		{"123 456", "123 456"},
+		{"  ", ""},
+	}
+	for _, tt := range tests {
+		if got := Clean(tt.raw); got != tt.want {
+			t.Errorf("Clean(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func loadAliases(t *testing.T, data string) []Alias {
+	path := filepath.Join(t.TempDir(), "aliases.json")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	aliases, err := LoadAliases(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return aliases
+}
+
+func transaction(name, iban, edrpou string) *dto.TransactionDTO {
+	return &dto.TransactionDTO{Transaction: dto.TransactionDTOTransaction{
+		CounterName: name, CounterIban: iban, CounterEdrpou: edrpou, Description: "Description"}}
+}
+
+func TestName(t *testing.T) {
+	aliases := loadAliases(t, `[
+		{"name": "Silpo", "patterns": ["(?i)silpo|сільпо"]},
+		{"name": "Kyivenergo", "edrpou": ["41946011"], "iban": ["UA21322313"]},
+		{"name": "Cleaned", "patterns": ["^Atb Kyiv$"]}
+	]`)
+	n, err := New(aliases, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		trans *dto.TransactionDTO
+		want  string
+	}{
+		{transaction("SILPO 123 KYIV", "", ""), "Silpo"},
+		{transaction("Сільпо", "", ""), "Silpo"},
+		{transaction("KYIVENERGO PAYMENT", "", "41946011"), "Kyivenergo"},
+		{transaction("Whatever", "UA21322313", ""), "Kyivenergo"},
+		// Patterns are matched against the cleaned name too
+		{transaction("ATB 12 KYIV", "", ""), "Atb"},
+		{transaction("", "", ""), "Description"},
+	}
+	for _, tt := range tests {
+		if got := n.Name(tt.trans); got != tt.want {
+			t.Errorf("Name(%q) = %q, want %q", tt.trans.Transaction.CounterName, got, tt.want)
+		}
+	}
+
+	trans := transaction("", "", "")
+	trans.CounterAccount = "Set by rule"
+	if n.Apply(trans); trans.CounterAccount != "Set by rule" {
+		t.Errorf("counter account = %q, want the one set by rule", trans.CounterAccount)
+	}
+}
+
+func TestStableKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	st, err := store.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := New(nil, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := n.Name(transaction("NOVA POSHTA 12", "", "31316718")); got != "Nova Poshta" {
+		t.Errorf("first name = %q", got)
+	}
+	if got := n.Name(transaction("NP Branch 5", "", "31316718")); got != "Nova Poshta" {
+		t.Errorf("name of the same key = %q, want the first one", got)
+	}
+	if err := n.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Names are loaded after restart and aliases added later take precedence
+	st, err = store.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err = New(nil, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := n.Name(transaction("NP Branch 5", "", "31316718")); got != "Nova Poshta" {
+		t.Errorf("name after restart = %q, want Nova Poshta", got)
+	}
+	n.SetAliases(loadAliases(t, `[{"name": "Nova Poshta Delivery", "patterns": ["(?i)^np "]}]`))
+	if got := n.Name(transaction("NP Branch 5", "", "31316718")); got != "Nova Poshta Delivery" {
+		t.Errorf("name with alias = %q, want Nova Poshta Delivery", got)
+	}
+}
@@ -0,0 +1,16 @@
+package payee
+
+// namesKey - store key of payee names by counterparty edrpou or iban
+const namesKey = "payee.names"
+
+// noiseWords are dropped from payee names: legal forms, countries and cities
+// card terminals add to merchant names. Compared in upper case
+var noiseWords = map[string]bool{
+	"ТОВ": true, "ФОП": true, "ПП": true, "ПАТ": true, "ПРАТ": true, "АТ": true,
+	"TOV": true, "FOP": true, "LLC": true, "LTD": true, "INC": true, "GMBH": true,
+	"UA": true, "UKR": true, "UKRAINE": true, "УКРАЇНА": true,
+	"KYIV": true, "KIEV": true, "KYYIV": true, "КИЇВ": true, "КИЕВ": true,
+	"LVIV": true, "ЛЬВІВ": true, "ODESA": true, "ODESSA": true, "ОДЕСА": true,
+	"KHARKIV": true, "ХАРКІВ": true, "DNIPRO": true, "ДНІПРО": true,
+	"ZAPORIZHZHIA": true, "ЗАПОРІЖЖЯ": true, "VINNYTSIA": true, "ВІННИЦЯ": true,
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/sudores/firefly-iii-bank-sync/bank/mailbox"
+	"github.com/sudores/firefly-iii-bank-sync/bank/sms"
+	"github.com/sudores/firefly-iii-bank-sync/cnf"
+	firelfyiii "github.com/sudores/firefly-iii-bank-sync/dest/fireflyiii"
+	"github.com/sudores/firefly-iii-bank-sync/payee"
+	"github.com/sudores/firefly-iii-bank-sync/rules"
+)
+
+// reloadDebounce - delay after config file change before reload, editors write files in several steps
+const reloadDebounce = time.Second
+
+// reloadable parameters are applied in place, others require restart
+var reloadable = map[string]bool{
+	"LOG_LEVEL":          true,
+	"FFI_DRY_RUN":        true,
+	"firefly.accounts":   true,
+	"SMS_TEMPLATES_FILE": true,
+	"RULES_FILE":         true,
+	"firefly.budgets":    true,
+	"FFI_BILLS":          true,
+	"PAYEE_ALIASES_FILE": true,
+}
+
+// reloader applies configuration changes to the running daemon. In-flight
+// transactions and monobank webhook are not affected
+type reloader struct {
+	mu  sync.Mutex
+	cfg *cnf.Cnf
+
+	fw  *forwarder
+	ffi *firelfyiii.FireflyiiiConnection
+	// sms is nil when sms source is disabled
+	sms   *sms.SMSConnection
+	rules *rules.Engine
+	// payees is nil when payee accounts are disabled
+	payees *payee.Normalizer
+
+	mailboxCancel context.CancelFunc
+	// mailboxDone is closed when mailbox source is stopped
+	mailboxDone chan struct{}
+}
+
+func newReloader(cfg *cnf.Cnf, fw *forwarder, ffi *firelfyiii.FireflyiiiConnection, smsConn *sms.SMSConnection,
+	rulesEngine *rules.Engine, payees *payee.Normalizer) *reloader {
+	return &reloader{cfg: cfg, fw: fw, ffi: ffi, sms: smsConn, rules: rulesEngine, payees: payees}
+}
+
+// startMailbox replaces running mailbox source with the configured one, if any. The
+// running source is kept when the new one fails to be created
+func (r *reloader) startMailbox(cfg *cnf.Cnf) error {
+	if cfg.IMAPAddress == "" {
+		r.stopMailbox()
+		return nil
+	}
+	mailboxConn, err := mailbox.NewMailboxConnection(cfg.IMAPAddress, cfg.IMAPUsername, cfg.IMAPPassword,
+		cfg.IMAPFolder, cfg.IMAPParsersFile, cfg.IMAPProcessedFlag, cfg.IMAPTLS, cfg.IMAPPollInterval)
+	if err != nil {
+		return err
+	}
+	// Attachments are imported in the formats of import command
+	templates, err := sms.NewTemplates(cfg.SMSTemplatesFile)
+	if err != nil {
+		return err
+	}
+	mailboxConn.RegisterImporter(".json", mailbox.JSONImporter{})
+	mailboxConn.RegisterImporter(".txt", mailbox.SMSImporter{Templates: templates})
+	r.stopMailbox()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	r.mailboxCancel, r.mailboxDone = cancel, done
+	r.fw.forward("mailbox", mailboxConn.TransactionChan)
+	go func() {
+		defer close(done)
+		log.Info().Msg("Mailbox starting polling")
+		mailboxConn.Serve(ctx)
+		close(mailboxConn.TransactionChan)
+	}()
+	return nil
+}
+
+// stopMailbox stops running mailbox source and waits for it
+func (r *reloader) stopMailbox() {
+	if r.mailboxCancel == nil {
+		return
+	}
+	r.mailboxCancel()
+	<-r.mailboxDone
+	r.mailboxCancel, r.mailboxDone = nil, nil
+}
+
+// stop stops sources started by reloader
+func (r *reloader) stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopMailbox()
+}
+
+// reload parses configuration and applies changed parameters. Invalid
+// configuration is rejected as a whole, the running one is kept
+func (r *reloader) reload() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	log.Info().Msg("Reloading configuration")
+	cfg, err := cnf.Parse()
+	if err == nil {
+		err = validateConfig(cfg)
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Configuration is invalid, keeping the running one")
+		return
+	}
+
+	changed := cnf.Changed(r.cfg, cfg)
+	restart := []string{}
+	mailboxChanged := false
+	for _, name := range changed {
+		if name == "SMS_TEMPLATES_FILE" && cfg.IMAPAddress != "" {
+			// Templates of sms attachments
+			mailboxChanged = true
+		}
+		switch {
+		case strings.HasPrefix(name, "IMAP_"):
+			mailboxChanged = true
+		case name == "SMS_TEMPLATES_FILE" && r.sms == nil:
+			// Templates of disabled source are applied when it is enabled on restart
+		case !reloadable[name]:
+			restart = append(restart, cnf.Name(name))
+		}
+	}
+
+	if level, err := zerolog.ParseLevel(cfg.LogLevel); err == nil {
+		zerolog.SetGlobalLevel(level)
+	}
+	r.ffi.SetAccounts(accountMappings(cfg))
+	r.ffi.SetBills(cfg.FFIBills)
+	if cfg.FFIDryRun != r.cfg.FFIDryRun {
+		log.Warn().Msgf("Dry run is set to %t", cfg.FFIDryRun)
+		r.ffi.SetDryRun(cfg.FFIDryRun, nil)
+	}
+	if r.sms != nil && cfg.SMSTemplatesFile != r.cfg.SMSTemplatesFile {
+		if err := r.sms.SetTemplates(cfg.SMSTemplatesFile); err != nil {
+			log.Error().Err(err).Msg("Failed to reload sms templates")
+		}
+	}
+	// Rules file is read again even if its path is the same
+	if list, err := rules.Load(cfg.RulesFile); err != nil {
+		log.Error().Err(err).Msg("Failed to reload rules")
+	} else {
+		r.rules.SetRules(list)
+	}
+	budgetList, _ := budgets(cfg)
+	r.rules.SetBudgets(budgetList)
+	if r.payees != nil {
+		if aliases, err := payee.LoadAliases(cfg.PayeeAliasesFile); err != nil {
+			log.Error().Err(err).Msg("Failed to reload payee aliases")
+		} else {
+			r.payees.SetAliases(aliases)
+		}
+	}
+	if mailboxChanged {
+		if err := r.startMailbox(cfg); err != nil {
+			log.Error().Err(err).Msg("Failed to restart mailbox source")
+		}
+	}
+
+	if len(restart) != 0 {
+		log.Warn().Msgf("Restart is required to apply: %s", strings.Join(restart, ", "))
+	}
+	log.Info().Msgf("Configuration reloaded, %d parameters changed", len(changed))
+	r.cfg = cfg
+}
+
+// watch reloads configuration on hup signal and config file change until ctx is done
+func (r *reloader) watch(ctx context.Context, hup <-chan os.Signal) {
+	var changes <-chan fsnotify.Event
+	var watchErrs <-chan error
+	path := cnf.File()
+	target := resolve(path)
+	if path != "" {
+		watcher, err := fsnotify.NewWatcher()
+		if err == nil {
+			// Directory is watched as editors replace files instead of writing them
+			err = watcher.Add(filepath.Dir(path))
+		}
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to watch config file, reload it with SIGHUP")
+		} else {
+			defer watcher.Close()
+			changes, watchErrs = watcher.Events, watcher.Errors
+		}
+	}
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.reload()
+		case event := <-changes:
+			// Kubernetes replaces the ..data symlink of ConfigMap directory, config
+			// file itself is not changed, so the resolved path is compared too
+			if newTarget := resolve(path); filepath.Clean(event.Name) == filepath.Clean(path) ||
+				newTarget != target {
+				target = newTarget
+				debounce = time.After(reloadDebounce)
+			}
+		case err := <-watchErrs:
+			log.Warn().Err(err).Msg("Config file watcher failed")
+		case <-debounce:
+			debounce = nil
+			r.reload()
+		}
+	}
+}
+
+// resolve returns path with symlinks evaluated, or path itself if it can't be evaluated
+func resolve(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return path
+}
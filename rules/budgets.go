@@ -0,0 +1,69 @@
+package rules
+
+import (
+	"fmt"
+
+	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+)
+
+// Budget assigns firefly-iii budget to withdrawals of its categories or MCC codes
+type Budget struct {
+	Budget     string   `json:"budget"`
+	Categories []string `json:"categories"`
+	// MCC - codes or ranges of codes, e.g. "5411" or "5811-5814"
+	MCC []string `json:"mcc"`
+
+	mcc []intRange
+}
+
+// CompileBudgets prepares budgets for matching
+func CompileBudgets(budgets []Budget) ([]Budget, error) {
+	for i := range budgets {
+		var err error
+		if budgets[i].mcc, err = parseRanges(budgets[i].MCC); err != nil {
+			return nil, fmt.Errorf("Failed to compile budget %q: %w", budgets[i].Budget, err)
+		}
+	}
+	return budgets, nil
+}
+
+// SetBudgets replaces budgets of engine with compiled budgets
+func (e *Engine) SetBudgets(budgets []Budget) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.budgets = budgets
+}
+
+// assignBudgets sets budget of withdrawal and its splits having none. Category
+// is matched first, so budget of category set by rule wins over the MCC one
+func (e *Engine) assignBudgets(trans *dto.TransactionDTO) {
+	if trans.Transaction.Amount >= 0 {
+		return
+	}
+	mcc := int(trans.Transaction.MCC)
+	if trans.Budget == "" {
+		trans.Budget = e.budgetOf(trans.Category, mcc)
+	}
+	for i := range trans.Splits {
+		s := &trans.Splits[i]
+		if s.Budget == "" && s.Category != "" {
+			s.Budget = e.budgetOf(s.Category, mcc)
+		}
+	}
+}
+
+func (e *Engine) budgetOf(category string, mcc int) string {
+	if category != "" {
+		for _, b := range e.budgets {
+			if contains(b.Categories, category) {
+				return b.Budget
+			}
+		}
+	}
+	for _, b := range e.budgets {
+		if len(b.mcc) != 0 && inRanges(b.mcc, mcc) {
+			return b.Budget
+		}
+	}
+	return ""
+}
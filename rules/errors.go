@@ -0,0 +1,13 @@
+package rules
+
+import "errors"
+
+var (
+	ErrBadRange   = errors.New("Range should be a number or two numbers separated by dash")
+	ErrBadWeekday = errors.New("Weekday is unrecognized. Eligible weekdays are: mon, tue, wed, thu, fri, sat, sun")
+	ErrBadTime    = errors.New("Time should be in 2006-01-02 or RFC3339 format")
+
+	ErrExprBudget = errors.New("Rule expression exceeded operations budget")
+	ErrExprResult = errors.New("Rule action expression should return map of actions or nil")
+	ErrSplits     = errors.New("Splits amounts should sum up to the transaction amount")
+)
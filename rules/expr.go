@@ -0,0 +1,210 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/vm"
+	"github.com/rmg/iso4217"
+	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+)
+
+// exprEnv - variables available to rule expressions. Amounts are in currency
+// units, negative for withdrawals
+type exprEnv struct {
+	Source          string    `expr:"source"`
+	Account         string    `expr:"account"`
+	ID              string    `expr:"id"`
+	Amount          float64   `expr:"amount"`
+	Currency        string    `expr:"currency"`
+	ForeignAmount   float64   `expr:"foreign_amount"`
+	ForeignCurrency string    `expr:"foreign_currency"`
+	Balance         float64   `expr:"balance"`
+	MCC             int       `expr:"mcc"`
+	Description     string    `expr:"description"`
+	Comment         string    `expr:"comment"`
+	CounterName     string    `expr:"counter_name"`
+	CounterIban     string    `expr:"counter_iban"`
+	CounterEdrpou   string    `expr:"counter_edrpou"`
+	Time            time.Time `expr:"time"`
+	Category        string    `expr:"category"`
+	Budget          string    `expr:"budget"`
+	Tags            []string  `expr:"tags"`
+	CounterAccount  string    `expr:"counter_account"`
+	Transfer        string    `expr:"transfer"`
+
+	// steps - predicate iterations left for the run
+	steps *int
+}
+
+// exprResult - modifications returned by action expression
+type exprResult struct {
+	Actions
+	Description string `json:"description"`
+	// Splits - parts of transaction. Amount of the last one may be omitted, it gets the rest
+	Splits []exprSplit `json:"splits"`
+}
+
+type exprSplit struct {
+	Amount      *float64 `json:"amount"`
+	Description string   `json:"description"`
+	Category    string   `json:"category"`
+	Budget      string   `json:"budget"`
+}
+
+func newExprEnv(source string, trans *dto.TransactionDTO) exprEnv {
+	t := trans.Transaction
+	currency, _ := iso4217.ByCode(int(t.CurrencyCode))
+	foreignCurrency, _ := iso4217.ByCode(int(t.ForeignCurrencyCode))
+	return exprEnv{
+		Source:          source,
+		Account:         trans.AccountID,
+		ID:              t.ID,
+		Amount:          float64(t.Amount) / 100,
+		Currency:        currency,
+		ForeignAmount:   float64(t.ForeignAmount) / 100,
+		ForeignCurrency: foreignCurrency,
+		Balance:         float64(t.Balance) / 100,
+		MCC:             int(t.MCC),
+		Description:     t.Description,
+		Comment:         t.Comment,
+		CounterName:     t.CounterName,
+		CounterIban:     t.CounterIban,
+		CounterEdrpou:   t.CounterEdrpou,
+		Time:            t.Time.Local(),
+		Category:        trans.Category,
+		Budget:          trans.Budget,
+		Tags:            append([]string{}, trans.Tags...),
+		CounterAccount:  trans.CounterAccount,
+		Transfer:        trans.TransferAccountID,
+		steps:           new(int),
+	}
+}
+
+// compileExpr compiles expression over exprEnv, condition ones must return bool
+func compileExpr(input string, condition bool) (*vm.Program, error) {
+	opts := []expr.Option{expr.Env(exprEnv{}), expr.MaxNodes(exprMaxNodes),
+		expr.Function(exprStepFunc, exprStep, new(func(exprEnv) bool)), expr.Patch(stepPatcher{})}
+	if condition {
+		opts = append(opts, expr.AsBool())
+	}
+	return expr.Compile(input, opts...)
+}
+
+// stepPatcher counts iterations of predicates (map, filter, reduce and so on),
+// the only loops of expression language, by prepending step call to their bodies
+type stepPatcher struct{}
+
+func (stepPatcher) Visit(node *ast.Node) {
+	p, ok := (*node).(*ast.PredicateNode)
+	if !ok {
+		return
+	}
+	step := &ast.CallNode{
+		Callee:    &ast.IdentifierNode{Value: exprStepFunc},
+		Arguments: []ast.Node{&ast.IdentifierNode{Value: "$env"}},
+	}
+	p.Node = &ast.SequenceNode{Nodes: []ast.Node{step, p.Node}}
+}
+
+// exprStep takes a step of the run budget, failing the run when it is spent
+func exprStep(params ...any) (any, error) {
+	env := params[0].(exprEnv)
+	if *env.steps >= exprMaxSteps {
+		return nil, ErrExprBudget
+	}
+	*env.steps++
+	return true, nil
+}
+
+// runExpr runs program with exprMaxSteps predicate iterations. Memory use is
+// bounded by vm budget
+func runExpr(program *vm.Program, env exprEnv) (any, error) {
+	if env.steps == nil {
+		env.steps = new(int)
+	}
+	return expr.Run(program, env)
+}
+
+// matchExpr reports whether condition expression is true for transaction
+func (c *Conditions) matchExpr(source string, trans *dto.TransactionDTO) (bool, error) {
+	out, err := runExpr(c.expr, newExprEnv(source, trans))
+	if err != nil {
+		return false, err
+	}
+	return out.(bool), nil
+}
+
+// applyExpr modifies transaction with the result of action expression.
+// Nil result leaves transaction as is. Returns whether transaction is dropped
+func (a *Actions) applyExpr(source string, trans *dto.TransactionDTO) (bool, error) {
+	out, err := runExpr(a.expr, newExprEnv(source, trans))
+	if err != nil || out == nil {
+		return false, err
+	}
+	if _, ok := out.(map[string]any); !ok {
+		return false, fmt.Errorf("%w, got %T", ErrExprResult, out)
+	}
+	data, err := json.Marshal(out)
+	if err != nil {
+		return false, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	res := exprResult{}
+	if err := dec.Decode(&res); err != nil {
+		return false, fmt.Errorf("%w: %s", ErrExprResult, err)
+	}
+	if res.Drop {
+		return true, nil
+	}
+	// Splits are checked before transaction is modified
+	splits, err := res.splits(trans.Transaction.Amount)
+	if err != nil {
+		return false, err
+	}
+	res.Actions.expr = nil
+	res.Actions.apply(trans)
+	if res.Description != "" {
+		trans.Transaction.Description = res.Description
+	}
+	if splits != nil {
+		trans.Splits = splits
+	}
+	return false, nil
+}
+
+// splits converts splits of result to transaction splits summing up to amount
+func (r *exprResult) splits(amount int64) ([]dto.Split, error) {
+	if len(r.Splits) == 0 {
+		return nil, nil
+	}
+	total := amount
+	if total < 0 {
+		total = -total
+	}
+	splits := []dto.Split{}
+	var sum int64
+	for i, v := range r.Splits {
+		s := dto.Split{Description: v.Description, Category: v.Category, Budget: v.Budget}
+		switch {
+		case v.Amount != nil:
+			s.Amount = int64(math.Round(math.Abs(*v.Amount) * 100))
+		case i == len(r.Splits)-1:
+			s.Amount = total - sum
+		default:
+			return nil, fmt.Errorf("%w: split %d has no amount", ErrSplits, i)
+		}
+		sum += s.Amount
+		splits = append(splits, s)
+	}
+	if sum != total {
+		return nil, fmt.Errorf("%w: %.2f of %.2f", ErrSplits, float64(sum)/100, float64(total)/100)
+	}
+	return splits, nil
+}
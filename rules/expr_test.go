@@ -0,0 +1,193 @@
+package rules
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+)
+
+func testTransaction() *dto.TransactionDTO {
+	return &dto.TransactionDTO{
+		AccountID: "acc",
+		Tags:      []string{"card"},
+		Transaction: dto.TransactionDTOTransaction{
+			ID:           "t1",
+			Time:         time.Date(2026, 10, 12, 10, 0, 0, 0, time.Local),
+			Description:  "Silpo",
+			MCC:          5411,
+			Amount:       -12050,
+			CurrencyCode: 980,
+		},
+	}
+}
+
+func TestConditionExpr(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`amount < -100 && currency == "UAH"`, true},
+		{`mcc in 5411..5499 and "card" in tags`, true},
+		{`description matches "(?i)^atb"`, false},
+		{`time.Weekday().String() == "Monday" && source == "monobank"`, true},
+		{`any(tags, # == "cash")`, false},
+	}
+	for _, tt := range tests {
+		c := Conditions{Expr: tt.expr}
+		if err := c.compile(); err != nil {
+			t.Fatalf("%s: %s", tt.expr, err)
+		}
+		got, err := c.match("monobank", testTransaction())
+		if err != nil {
+			t.Fatalf("%s: %s", tt.expr, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestConditionExprNotBool(t *testing.T) {
+	c := Conditions{Expr: `amount`}
+	if err := c.compile(); err == nil {
+		t.Error("condition returning number is compiled")
+	}
+}
+
+func TestActionExprSplits(t *testing.T) {
+	tests := []struct {
+		name  string
+		expr  string
+		want  []dto.Split
+		errIs error
+	}{
+		{
+			name: "last split gets the rest",
+			expr: `{"splits": [{"amount": 100, "category": "Food"}, {"category": "Home"}]}`,
+			want: []dto.Split{{Amount: 10000, Category: "Food"}, {Amount: 2050, Category: "Home"}},
+		},
+		{
+			name: "amounts sum up",
+			expr: `{"splits": [{"amount": -20.5}, {"amount": 100}]}`,
+			want: []dto.Split{{Amount: 2050}, {Amount: 10000}},
+		},
+		{
+			name:  "amounts exceed the transaction",
+			expr:  `{"splits": [{"amount": 100}, {"amount": 100}]}`,
+			errIs: ErrSplits,
+		},
+		{
+			name:  "middle split without amount",
+			expr:  `{"splits": [{"category": "Food"}, {"amount": 100}]}`,
+			errIs: ErrSplits,
+		},
+		{
+			name:  "not a map",
+			expr:  `"Food"`,
+			errIs: ErrExprResult,
+		},
+		{
+			name:  "unknown key",
+			expr:  `{"categroy": "Food"}`,
+			errIs: ErrExprResult,
+		},
+	}
+	for _, tt := range tests {
+		a := Actions{Expr: tt.expr}
+		if err := a.compile(); err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		trans := testTransaction()
+		_, err := a.applyExpr("monobank", trans)
+		if !errors.Is(err, tt.errIs) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.errIs)
+			continue
+		}
+		if !reflect.DeepEqual(trans.Splits, tt.want) {
+			t.Errorf("%s: splits = %+v, want %+v", tt.name, trans.Splits, tt.want)
+		}
+	}
+}
+
+func TestActionExprActions(t *testing.T) {
+	a := Actions{Expr: `amount < 0 ? {"category": "Groceries", "tags": ["food"], "description": upper(description)} : nil`}
+	if err := a.compile(); err != nil {
+		t.Fatal(err)
+	}
+	trans := testTransaction()
+	if _, err := a.applyExpr("monobank", trans); err != nil {
+		t.Fatal(err)
+	}
+	if trans.Category != "Groceries" || trans.Transaction.Description != "SILPO" {
+		t.Errorf("category, description = %q, %q", trans.Category, trans.Transaction.Description)
+	}
+	if !reflect.DeepEqual(trans.Tags, []string{"card", "food"}) {
+		t.Errorf("tags = %v", trans.Tags)
+	}
+	drop := Actions{Expr: `{"drop": true}`}
+	if err := drop.compile(); err != nil {
+		t.Fatal(err)
+	}
+	if dropped, err := drop.applyExpr("monobank", testTransaction()); err != nil || !dropped {
+		t.Errorf("dropped = %v, %v", dropped, err)
+	}
+}
+
+// TestExprBudget checks expression spinning in nested loops is stopped by
+// operations budget shortly, while loops within it run as usual
+func TestExprBudget(t *testing.T) {
+	c := Conditions{Expr: `len(filter(1..60000, # % 2 == 0)) == 30000`}
+	if err := c.compile(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := c.match("monobank", testTransaction()); err != nil || !ok {
+		t.Errorf("loop within budget = %v, %v", ok, err)
+	}
+	// Budget is per run
+	if ok, err := c.match("monobank", testTransaction()); err != nil || !ok {
+		t.Errorf("second run = %v, %v", ok, err)
+	}
+
+	spin := Conditions{Expr: `let r = 1..1000; reduce(r, reduce(r, reduce(r, #acc + 1, 0), 0), 0) > 0`}
+	if err := spin.compile(); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err := spin.match("monobank", testTransaction())
+	if !errors.Is(err, ErrExprBudget) {
+		t.Errorf("error = %v, want %v", err, ErrExprBudget)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("spinning expression stopped in %s", elapsed)
+	}
+
+	a := Actions{Expr: `{"tags": map(1..1000, map(1..1000, "x"))}`}
+	if err := a.compile(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.applyExpr("monobank", testTransaction()); !errors.Is(err, ErrExprBudget) {
+		t.Errorf("action error = %v, want %v", err, ErrExprBudget)
+	}
+}
+
+func TestEngineSkipsFailedRule(t *testing.T) {
+	list, err := Compile([]Rule{
+		{Name: "spin", If: Conditions{Expr: `reduce(1..1000, reduce(1..1000, #acc + 1, 0), 0) > 0`},
+			Then: Actions{Category: "Wrong"}},
+		{Name: "groceries", If: Conditions{MCC: []string{"5411"}}, Then: Actions{Category: "Groceries"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trans := testTransaction()
+	res := NewEngine(list, nil).Apply("monobank", trans)
+	if len(res.Errors) != 1 || !reflect.DeepEqual(res.Rules, []string{"groceries"}) {
+		t.Errorf("result = %+v", res)
+	}
+	if trans.Category != "Groceries" {
+		t.Errorf("category = %q, want Groceries", trans.Category)
+	}
+}
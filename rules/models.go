@@ -0,0 +1,292 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/expr-lang/expr/vm"
+	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+)
+
+// Rule transforms transactions matching all of its conditions with its actions
+type Rule struct {
+	Name string     `json:"name"`
+	If   Conditions `json:"if"`
+	Then Actions    `json:"then"`
+	// Stop - rules following the matched one are not applied
+	Stop bool `json:"stop"`
+}
+
+// Conditions of rule, empty ones are not checked
+type Conditions struct {
+	// Source - names of sources: monobank, sms, mailbox, import
+	Source  []string `json:"source"`
+	Account []string `json:"account"`
+	// MCC - codes or ranges of codes, e.g. "5411" or "5811-5814"
+	MCC []string `json:"mcc"`
+	// Description, CounterName - regular expressions
+	Description string   `json:"description"`
+	CounterName string   `json:"counter_name"`
+	CounterIban []string `json:"counter_iban"`
+	// AmountMin, AmountMax - bounds of amount in currency units, negative for withdrawals
+	AmountMin *float64 `json:"amount_min"`
+	AmountMax *float64 `json:"amount_max"`
+	// After, Before - bounds of transaction time, 2006-01-02 or RFC3339
+	After  string `json:"after"`
+	Before string `json:"before"`
+	// Weekdays - mon, tue, wed, thu, fri, sat, sun
+	Weekdays []string `json:"weekdays"`
+	// Days - days of month or ranges of days, e.g. "1-7"
+	Days []string `json:"days"`
+	// Expr - expression returning bool, see exprEnv for the variables
+	Expr string `json:"expr"`
+
+	mcc         []intRange
+	days        []intRange
+	description *regexp.Regexp
+	counterName *regexp.Regexp
+	amountMin   *int64
+	amountMax   *int64
+	after       time.Time
+	before      time.Time
+	weekdays    map[time.Weekday]bool
+	expr        *vm.Program
+}
+
+// Actions of rule, empty ones are not applied
+type Actions struct {
+	Category string   `json:"category"`
+	Budget   string   `json:"budget"`
+	Tags     []string `json:"tags"`
+	// Payee - counterparty name replacing transaction description and counter name
+	Payee string `json:"payee"`
+	// CounterAccount - name of expense or revenue account of counterparty
+	CounterAccount string `json:"counter_account"`
+	// Transfer - id of own account the transaction is a transfer to or from
+	Transfer string `json:"transfer"`
+	// Drop - transaction is not created
+	Drop bool `json:"drop"`
+	// Expr - expression returning map of actions to apply (plus description and
+	// splits) or nil, applied after the other actions
+	Expr string `json:"expr"`
+
+	expr *vm.Program
+}
+
+// intRange - inclusive range of integers
+type intRange struct {
+	from, to int
+}
+
+// Load reads rules from json file with an array of Rule objects and compiles them.
+// No rules are returned for empty path
+func Load(path string) ([]Rule, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules := []Rule{}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+	return Compile(rules)
+}
+
+// Compile prepares rules for matching
+func Compile(rules []Rule) ([]Rule, error) {
+	for i := range rules {
+		err := rules[i].If.compile()
+		if err == nil {
+			err = rules[i].Then.compile()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Failed to compile rule %q: %w", rules[i].Name, err)
+		}
+	}
+	return rules, nil
+}
+
+func (a *Actions) compile() error {
+	if a.Expr == "" {
+		return nil
+	}
+	var err error
+	a.expr, err = compileExpr(a.Expr, false)
+	return err
+}
+
+func (c *Conditions) compile() error {
+	var err error
+	if c.mcc, err = parseRanges(c.MCC); err != nil {
+		return err
+	}
+	if c.days, err = parseRanges(c.Days); err != nil {
+		return err
+	}
+	if c.Description != "" {
+		if c.description, err = regexp.Compile(c.Description); err != nil {
+			return err
+		}
+	}
+	if c.CounterName != "" {
+		if c.counterName, err = regexp.Compile(c.CounterName); err != nil {
+			return err
+		}
+	}
+	c.amountMin, c.amountMax = minorUnits(c.AmountMin), minorUnits(c.AmountMax)
+	if c.after, err = parseTime(c.After); err != nil {
+		return err
+	}
+	if c.before, err = parseTime(c.Before); err != nil {
+		return err
+	}
+	c.weekdays = map[time.Weekday]bool{}
+	for _, v := range c.Weekdays {
+		day, ok := weekdays[strings.ToLower(v)]
+		if !ok {
+			return fmt.Errorf("%w: %q", ErrBadWeekday, v)
+		}
+		c.weekdays[day] = true
+	}
+	if c.Expr != "" {
+		if c.expr, err = compileExpr(c.Expr, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// match reports whether transaction of source meets all the conditions.
+// Expression is checked the last
+func (c *Conditions) match(source string, trans *dto.TransactionDTO) (bool, error) {
+	if !c.matchStatic(source, trans) {
+		return false, nil
+	}
+	if c.expr == nil {
+		return true, nil
+	}
+	return c.matchExpr(source, trans)
+}
+
+func (c *Conditions) matchStatic(source string, trans *dto.TransactionDTO) bool {
+	t := trans.Transaction
+	local := t.Time.Local()
+	switch {
+	case len(c.Source) != 0 && !contains(c.Source, source):
+		return false
+	case len(c.Account) != 0 && !contains(c.Account, trans.AccountID):
+		return false
+	case len(c.mcc) != 0 && !inRanges(c.mcc, int(t.MCC)):
+		return false
+	case c.description != nil && !c.description.MatchString(t.Description):
+		return false
+	case c.counterName != nil && !c.counterName.MatchString(t.CounterName):
+		return false
+	case len(c.CounterIban) != 0 && !contains(c.CounterIban, t.CounterIban):
+		return false
+	case c.amountMin != nil && t.Amount < *c.amountMin:
+		return false
+	case c.amountMax != nil && t.Amount > *c.amountMax:
+		return false
+	case !c.after.IsZero() && t.Time.Before(c.after):
+		return false
+	case !c.before.IsZero() && !t.Time.Before(c.before):
+		return false
+	case len(c.weekdays) != 0 && !c.weekdays[local.Weekday()]:
+		return false
+	case len(c.days) != 0 && !inRanges(c.days, local.Day()):
+		return false
+	}
+	return true
+}
+
+// apply modifies transaction with the actions
+func (a *Actions) apply(trans *dto.TransactionDTO) {
+	if a.Category != "" {
+		trans.Category = a.Category
+	}
+	if a.Budget != "" {
+		trans.Budget = a.Budget
+	}
+	for _, v := range a.Tags {
+		if !contains(trans.Tags, v) {
+			trans.Tags = append(trans.Tags, v)
+		}
+	}
+	if a.Payee != "" {
+		trans.Transaction.Description = a.Payee
+		trans.Transaction.CounterName = a.Payee
+	}
+	if a.CounterAccount != "" {
+		trans.CounterAccount = a.CounterAccount
+	}
+	if a.Transfer != "" {
+		trans.TransferAccountID = a.Transfer
+	}
+}
+
+func parseRanges(values []string) ([]intRange, error) {
+	ranges := []intRange{}
+	for _, v := range values {
+		from, to, isRange := strings.Cut(strings.TrimSpace(v), "-")
+		if !isRange {
+			to = from
+		}
+		a, errFrom := strconv.Atoi(strings.TrimSpace(from))
+		b, errTo := strconv.Atoi(strings.TrimSpace(to))
+		if errFrom != nil || errTo != nil || a > b {
+			return nil, fmt.Errorf("%w: %q", ErrBadRange, v)
+		}
+		ranges = append(ranges, intRange{from: a, to: b})
+	}
+	return ranges, nil
+}
+
+func inRanges(ranges []intRange, v int) bool {
+	for _, r := range ranges {
+		if v >= r.from && v <= r.to {
+			return true
+		}
+	}
+	return false
+}
+
+func minorUnits(v *float64) *int64 {
+	if v == nil {
+		return nil
+	}
+	res := int64(math.Round(*v * 100))
+	return &res
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, s, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %q", ErrBadTime, s)
+	}
+	return t, nil
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package rules
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+)
+
+// Engine applies rules to transactions before they are passed to destination
+type Engine struct {
+	mu    sync.RWMutex
+	rules []Rule
+	// budgets assigned to withdrawals after rules
+	budgets []Budget
+}
+
+// Result of rules applied to transaction
+type Result struct {
+	// Rules - names of matched rules in order of application
+	Rules []string `json:"rules"`
+	// Drop - transaction must not be passed on
+	Drop bool `json:"drop"`
+	// Errors - failures of rule expressions, failed rules are not applied
+	Errors []string `json:"errors,omitempty"`
+}
+
+// NewEngine builds engine of compiled rules and budgets
+func NewEngine(rules []Rule, budgets []Budget) *Engine {
+	return &Engine{rules: rules, budgets: budgets}
+}
+
+// SetRules replaces rules of engine with compiled rules
+func (e *Engine) SetRules(rules []Rule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rules = rules
+}
+
+// Apply modifies transaction received from source with actions of matching rules in
+// their order. Application stops at dropping rule or rule with Stop set. Budgets
+// are assigned to transactions left without one by rules
+func (e *Engine) Apply(source string, trans *dto.TransactionDTO) Result {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	res := Result{Rules: []string{}}
+	defer func() {
+		if !res.Drop {
+			e.assignBudgets(trans)
+		}
+	}()
+	for i := range e.rules {
+		r := &e.rules[i]
+		matched, err := r.If.match(source, trans)
+		if err != nil {
+			res.fail(r, trans, err)
+			continue
+		}
+		if !matched {
+			continue
+		}
+		log.Debug().Msgf("Rule %q matched transaction %s", r.Name, trans.Transaction.ID)
+		if r.Then.Drop {
+			res.Rules = append(res.Rules, r.Name)
+			res.Drop = true
+			return res
+		}
+		// Actions are applied to copy, so failed expression leaves transaction as is
+		t := *trans
+		t.Tags = append([]string{}, trans.Tags...)
+		r.Then.apply(&t)
+		if r.Then.expr != nil {
+			drop, err := r.Then.applyExpr(source, &t)
+			if err != nil {
+				res.fail(r, trans, err)
+				continue
+			}
+			if drop {
+				res.Rules = append(res.Rules, r.Name)
+				res.Drop = true
+				return res
+			}
+		}
+		*trans = t
+		res.Rules = append(res.Rules, r.Name)
+		if r.Stop {
+			break
+		}
+	}
+	return res
+}
+
+func (res *Result) fail(r *Rule, trans *dto.TransactionDTO, err error) {
+	log.Warn().Err(err).Msgf("Rule %q failed on transaction %s", r.Name, trans.Transaction.ID)
+	res.Errors = append(res.Errors, fmt.Sprintf("%s: %s", r.Name, err))
+}
@@ -0,0 +1,192 @@
+package rules
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+)
+
+func loadRules(t *testing.T, data string) []Rule {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	list, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+func TestConditions(t *testing.T) {
+	// testTransaction is Monday 2026-10-12 10:00 local, mcc 5411, amount -120.50
+	tests := []struct {
+		name string
+		cond string
+		want bool
+	}{
+		{"empty", `{}`, true},
+		{"source", `{"source": ["sms", "monobank"]}`, true},
+		{"other source", `{"source": ["sms"]}`, false},
+		{"account", `{"account": ["acc"]}`, true},
+		{"mcc range", `{"mcc": ["5811-5814", "5400-5499"]}`, true},
+		{"other mcc", `{"mcc": ["5812"]}`, false},
+		{"description", `{"description": "(?i)^silpo$"}`, true},
+		{"counter name", `{"counter_name": "Silpo"}`, false},
+		{"amount range", `{"amount_min": -200, "amount_max": -100}`, true},
+		{"amount over", `{"amount_min": -100}`, false},
+		{"after", `{"after": "2026-10-12"}`, true},
+		{"before", `{"before": "2026-10-12"}`, false},
+		{"weekdays", `{"weekdays": ["Mon", "tue"]}`, true},
+		{"other weekday", `{"weekdays": ["sun"]}`, false},
+		{"days", `{"days": ["10-15"]}`, true},
+		{"other days", `{"days": ["1", "20-31"]}`, false},
+		{"all", `{"source": ["monobank"], "mcc": ["5411"], "amount_max": 0, "days": ["12"], "expr": "amount < -100"}`, true},
+		{"expr fails", `{"mcc": ["5411"], "expr": "amount > 0"}`, false},
+	}
+	for _, tt := range tests {
+		list := loadRules(t, `[{"name": "r", "if": `+tt.cond+`}]`)
+		got, err := list[0].If.match("monobank", testTransaction())
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: match = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		rule string
+		want error
+	}{
+		{`{"if": {"mcc": ["54x"]}}`, ErrBadRange},
+		{`{"if": {"days": ["7-1-2"]}}`, ErrBadRange},
+		{`{"if": {"weekdays": ["monday"]}}`, ErrBadWeekday},
+		{`{"if": {"after": "12.10.2026"}}`, ErrBadTime},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "rules.json")
+		os.WriteFile(path, []byte(`[`+tt.rule+`]`), 0o600)
+		if _, err := Load(path); !errors.Is(err, tt.want) {
+			t.Errorf("%s: error = %v, want %v", tt.rule, err, tt.want)
+		}
+	}
+	for _, rule := range []string{`{"if": {"description": "("}}`, `{"if": {"expr": "amount +"}}`, `{"then": {"expr": "foo()"}}`} {
+		path := filepath.Join(t.TempDir(), "rules.json")
+		os.WriteFile(path, []byte(`[`+rule+`]`), 0o600)
+		if _, err := Load(path); err == nil {
+			t.Errorf("%s: loaded", rule)
+		}
+	}
+	if list, err := Load(""); err != nil || list != nil {
+		t.Errorf("Load of empty path = %v, %v", list, err)
+	}
+}
+
+func TestEngineApply(t *testing.T) {
+	list := loadRules(t, `[
+		{"name": "groceries", "if": {"mcc": ["5411"]}, "then": {"category": "Groceries", "tags": ["food", "card"]}},
+		{"name": "silpo", "if": {"description": "Silpo"}, "then": {"payee": "Silpo", "counter_account": "Silpo Market", "budget": "Food"},
+			"stop": true},
+		{"name": "after stop", "if": {}, "then": {"category": "Other"}}
+	]`)
+	trans := testTransaction()
+	res := NewEngine(list, nil).Apply("monobank", trans)
+	if !reflect.DeepEqual(res.Rules, []string{"groceries", "silpo"}) || res.Drop || len(res.Errors) != 0 {
+		t.Errorf("result = %+v", res)
+	}
+	if trans.Category != "Groceries" || trans.Budget != "Food" || trans.CounterAccount != "Silpo Market" ||
+		trans.Transaction.CounterName != "Silpo" {
+		t.Errorf("transaction = %+v", trans)
+	}
+	if !reflect.DeepEqual(trans.Tags, []string{"card", "food"}) {
+		t.Errorf("tags = %v", trans.Tags)
+	}
+}
+
+func TestEngineDrop(t *testing.T) {
+	list := loadRules(t, `[
+		{"name": "tag", "if": {}, "then": {"tags": ["seen"]}},
+		{"name": "cashback", "if": {"source": ["monobank"]}, "then": {"drop": true}},
+		{"name": "after drop", "if": {}, "then": {"category": "Other"}}
+	]`)
+	budgets, err := CompileBudgets([]Budget{{Budget: "Food", MCC: []string{"5411"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trans := testTransaction()
+	res := NewEngine(list, budgets).Apply("monobank", trans)
+	if !res.Drop || !reflect.DeepEqual(res.Rules, []string{"tag", "cashback"}) {
+		t.Errorf("result = %+v", res)
+	}
+	if trans.Category != "" || trans.Budget != "" {
+		t.Errorf("dropped transaction is modified after drop: %+v", trans)
+	}
+}
+
+func TestEngineKeepsTransactionOnFailedAction(t *testing.T) {
+	list := loadRules(t, `[
+		{"name": "bad splits", "if": {}, "then": {"category": "Wrong", "tags": ["wrong"], "expr": "{'splits': [{'amount': 1}]}"}}
+	]`)
+	trans := testTransaction()
+	res := NewEngine(list, nil).Apply("monobank", trans)
+	if len(res.Errors) != 1 || len(res.Rules) != 0 {
+		t.Errorf("result = %+v", res)
+	}
+	if trans.Category != "" || !reflect.DeepEqual(trans.Tags, []string{"card"}) {
+		t.Errorf("failed rule modified transaction: %+v", trans)
+	}
+}
+
+func TestAssignBudgets(t *testing.T) {
+	budgets, err := CompileBudgets([]Budget{
+		{Budget: "Home", Categories: []string{"Utilities"}},
+		{Budget: "Food", Categories: []string{"Groceries"}, MCC: []string{"5411", "5811-5814"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine(nil, budgets)
+
+	trans := testTransaction()
+	e.Apply("monobank", trans)
+	if trans.Budget != "Food" {
+		t.Errorf("budget by mcc = %q, want Food", trans.Budget)
+	}
+
+	trans = testTransaction()
+	trans.Category = "Utilities"
+	trans.Splits = []dto.Split{{Amount: 10000, Category: "Groceries"}, {Amount: 2050, Category: "Utilities", Budget: "Set"}}
+	e.Apply("monobank", trans)
+	if trans.Budget != "Home" || trans.Splits[0].Budget != "Food" || trans.Splits[1].Budget != "Set" {
+		t.Errorf("budgets = %q, %+v", trans.Budget, trans.Splits)
+	}
+
+	deposit := testTransaction()
+	deposit.Transaction.Amount = 5000
+	e.Apply("monobank", deposit)
+	if deposit.Budget != "" {
+		t.Errorf("deposit budget = %q, want none", deposit.Budget)
+	}
+
+	if _, err := CompileBudgets([]Budget{{Budget: "Bad", MCC: []string{"x"}}}); !errors.Is(err, ErrBadRange) {
+		t.Errorf("error = %v, want %v", err, ErrBadRange)
+	}
+}
+
+func TestWeekdayInLocalTime(t *testing.T) {
+	list := loadRules(t, `[{"name": "r", "if": {"weekdays": ["mon"], "days": ["12"]}}]`)
+	trans := testTransaction()
+	// The same moment in another zone is still Monday 12th locally
+	trans.Transaction.Time = trans.Transaction.Time.In(time.FixedZone("far", 13*3600))
+	if ok, _ := list[0].If.match("monobank", trans); !ok {
+		t.Error("weekday is not matched in local time")
+	}
+}
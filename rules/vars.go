@@ -0,0 +1,22 @@
+package rules
+
+import "time"
+
+const (
+	// exprMaxSteps - predicate iterations rule expression may take, tens of milliseconds
+	exprMaxSteps = 100000
+	// exprStepFunc - function counting predicate iterations, the name can't clash with identifiers
+	exprStepFunc = "$step"
+	// exprMaxNodes - size limit of rule expression
+	exprMaxNodes = 10000
+)
+
+var weekdays = map[string]time.Weekday{
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+	"sun": time.Sunday,
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sudores/firefly-iii-bank-sync/admin"
+	"github.com/sudores/firefly-iii-bank-sync/bank/mono"
+	"github.com/sudores/firefly-iii-bank-sync/bank/sms"
+	"github.com/sudores/firefly-iii-bank-sync/cnf"
+	firelfyiii "github.com/sudores/firefly-iii-bank-sync/dest/fireflyiii"
+	"github.com/sudores/firefly-iii-bank-sync/health"
+	"github.com/sudores/firefly-iii-bank-sync/journal"
+	"github.com/sudores/firefly-iii-bank-sync/metrics"
+	"github.com/sudores/firefly-iii-bank-sync/store"
+	"github.com/sudores/firefly-iii-bank-sync/tracing"
+)
+
+// listenDisabled - LISTEN_ADDRESS value that disables the listener, polling mode only
+const listenDisabled = "off"
+
+var errNotListening = errors.New("Listener is not serving requests")
+
+// serve runs the sync daemon until termination signal
+func serve(args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	cfg, err := loadConfig(os.Stdout)
+	if err != nil {
+		return err
+	}
+	if err := validateConfig(cfg); err != nil {
+		return err
+	}
+
+	tracingShutdown, err := tracing.Init(context.Background(), cfg.TracingExporter)
+	if err != nil {
+		return fmt.Errorf("Failed to initialize tracing: %w", err)
+	}
+
+	st, err := store.Open(cfg.StateFile)
+	if err != nil {
+		return fmt.Errorf("Failed to open state file: %w", err)
+	}
+
+	exit := make(chan os.Signal, 1)
+	signal.Notify(exit, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	jr, err := journal.New(st, cfg.JournalSize)
+	if err != nil {
+		return fmt.Errorf("Failed to load transactions journal: %w", err)
+	}
+
+	ffi := newFireflyiiiConnection(cfg, jr)
+	if cfg.FFIDryRun {
+		log.Warn().Msg("Dry run is enabled, transactions are not created in firefly-iii")
+		ffi.SetDryRun(true, nil)
+	}
+	ffiCtx, ffiCancel := context.WithCancel(context.Background())
+	defer ffiCancel()
+	ffiDone := make(chan struct{})
+	go func() {
+		defer close(ffiDone)
+		log.Info().Msg("Firefly-iii starting serving")
+		ffi.Serve(ffiCtx)
+	}()
+
+	// Background jobs and admin operations are stopped first on shutdown
+	bgCtx, bgCancel := context.WithCancel(context.Background())
+	defer bgCancel()
+
+	rulesEngine, err := newRulesEngine(cfg)
+	if err != nil {
+		return fmt.Errorf("Failed to load rules: %w", err)
+	}
+	payees, err := newPayeeNormalizer(cfg, st)
+	if err != nil {
+		return fmt.Errorf("Failed to load payee aliases: %w", err)
+	}
+	fw := newForwarder(jr, rulesEngine, payees, ffi.FireflyiiiTransactionChan)
+	fw.dispatch()
+
+	monoClient := mono.NewClient(cfg.MonoAPIURL, cfg.MonobankAPIToken)
+	mb, err := newMonoConnection(cfg, st, monoClient)
+	if err != nil {
+		return fmt.Errorf("Failed to initialize monobank source: %w", err)
+	}
+	log.Info().Msg("Monobank starting serving")
+	mb.Serve()
+	fw.forward("monobank", mb.TransactionChan)
+	if cfg.FFIBillsCheckInterval != 0 {
+		go reportUnpaidBills(bgCtx, ffi, st, cfg.FFIBillsCheckInterval, cfg.FFIBillsGrace)
+	}
+	if cfg.MonoJarsSyncInterval != 0 {
+		go syncSavingsGoals(bgCtx, mb, ffi, cfg.MonoJarsSyncInterval)
+	}
+	if cfg.MonoRatesSyncInterval != 0 {
+		go syncExchangeRates(bgCtx, mb, ffi, cfg.MonoRatesCurrencies, cfg.MonoRatesSyncInterval)
+	}
+
+	var smsConn *sms.SMSConnection
+	if cfg.SMSWebhookPath != "" || cfg.SMSFile != "" {
+		smsConn, err = sms.NewSMSConnection(cfg.SMSTemplatesFile, cfg.SMSWebhookPath, cfg.SMSWebhookSecret, cfg.SMSFile)
+		if err != nil {
+			return fmt.Errorf("Failed to initialize sms source: %w", err)
+		}
+		fw.forward("sms", smsConn.TransactionChan)
+		go func() {
+			if err := smsConn.Serve(); err != nil {
+				log.Error().Err(err).Msg("Sms source failed")
+			}
+		}()
+	}
+
+	rl := newReloader(cfg, fw, ffi, smsConn, rulesEngine, payees)
+	if err := rl.startMailbox(cfg); err != nil {
+		return fmt.Errorf("Failed to initialize mailbox source: %w", err)
+	}
+	go rl.watch(bgCtx, hup)
+
+	var adm *admin.Admin
+	if cfg.AdminToken != "" || cfg.AdminViewerToken != "" {
+		adm = admin.New(bgCtx, cfg.AdminToken, cfg.AdminViewerToken, jr)
+		adm.AddBackfiller("monobank", mb.Backfill)
+		adm.SetAccounts(ffi.AccountMappings)
+		adm.AddSource("monobank", func(ctx context.Context) (string, error) {
+			return mb.WebhookStatus()
+		}, mb.LastWebhook)
+		enabled := func(ctx context.Context) (string, error) {
+			return "enabled", nil
+		}
+		if cfg.SMSWebhookPath != "" || cfg.SMSFile != "" {
+			adm.AddSource("sms", enabled, nil)
+		}
+		if cfg.IMAPAddress != "" {
+			adm.AddSource("mailbox", enabled, nil)
+		}
+		adm.Register()
+	}
+
+	// listening is set while the listener is serving requests
+	var listening atomic.Bool
+	hc := health.New()
+	if cfg.ListenAddr != listenDisabled {
+		hc.AddLiveness("listener", func(ctx context.Context) (string, error) {
+			if !listening.Load() {
+				return "", errNotListening
+			}
+			return "serving on " + cfg.ListenAddr, nil
+		})
+	}
+	hc.AddReadiness("webhook", func(ctx context.Context) (string, error) {
+		return mb.WebhookStatus()
+	})
+	hc.AddReadiness("firefly", func(ctx context.Context) (string, error) {
+		return "", ffi.Check(ctx)
+	})
+	hc.AddReadiness("store", func(ctx context.Context) (string, error) {
+		return cfg.StateFile, st.CheckWritable()
+	})
+	hc.AddQueue("monobank", mb.QueueDepth)
+	hc.AddQueue("firefly", ffi.QueueDepth)
+	if cfg.HealthListenAddr == "" {
+		hc.Register()
+	}
+
+	metrics.RegisterQueueDepth("monobank", mb.QueueDepth)
+	metrics.RegisterQueueDepth("firefly", ffi.QueueDepth)
+	metrics.Register()
+
+	// Listener serves handlers registered on http.DefaultServeMux by sources and health checks
+	srv := &http.Server{Addr: cfg.ListenAddr}
+	healthSrv := &http.Server{Addr: cfg.HealthListenAddr, Handler: hc.Handler()}
+	listenErr := make(chan error, 2)
+	if cfg.ListenAddr == listenDisabled {
+		log.Info().Msg("Listener is disabled")
+	} else {
+		go listen(srv, "Listener", &listening, listenErr)
+	}
+	if cfg.HealthListenAddr != "" {
+		go listen(healthSrv, "Health listener", nil, listenErr)
+	} else if cfg.ListenAddr == listenDisabled {
+		log.Warn().Msgf("Health endpoints are not served, set %s to serve them", cnf.Name("HEALTH_LISTEN_ADDRESS"))
+	}
+
+	// Listener failure shuts the daemon down the same way, pending transactions are kept
+	var serveErr error
+	select {
+	case osSig := <-exit:
+		log.Info().Msgf("%s received. Shutting down...", osSig.String())
+	case serveErr = <-listenErr:
+		log.Error().Err(serveErr).Msg("Shutting down...")
+	}
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer shutdownCancel()
+
+	// Webhooks are not accepted anymore, requests being handled are finished
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Warn().Err(err).Msg("Listener shutdown failed with error")
+	}
+	if err := healthSrv.Shutdown(shutdownCtx); err != nil {
+		log.Warn().Err(err).Msg("Health listener shutdown failed with error")
+	}
+	bgCancel()
+	// Backfills emit to monobank source, so they are stopped before it
+	if adm != nil {
+		adm.Wait()
+	}
+	mb.Shutdown()
+	rl.stop()
+	// Transactions left in sources channels are recorded as pending
+	fw.stop()
+	ffiCancel()
+	<-ffiDone
+	if err := ffi.Shutdown(shutdownCtx); err != nil {
+		log.Warn().Err(err).Msg("Firefly-iii shutdown timed out")
+	}
+	if err := jr.Flush(); err != nil {
+		log.Warn().Err(err).Msg("Failed to persist transactions journal")
+	}
+	if payees != nil {
+		if err := payees.Flush(); err != nil {
+			log.Warn().Err(err).Msg("Failed to persist payee names")
+		}
+	}
+	if n := jr.Count(journal.StatusPending); n != 0 {
+		log.Info().Msgf("%d transactions are left pending till the next start", n)
+	}
+
+	tracingCtx, tracingCancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer tracingCancel()
+	if err := tracingShutdown(tracingCtx); err != nil {
+		log.Warn().Err(err).Msg("Failed to flush traces")
+	}
+
+	if serveErr != nil {
+		return serveErr
+	}
+	log.Info().Msg("Shutdown successful. Bye!!!")
+	return nil
+}
+
+// listen serves srv until it is shut down. Failure is sent to errs, listening is
+// set while requests are served, if not nil
+func listen(srv *http.Server, name string, listening *atomic.Bool, errs chan<- error) {
+	log.Info().Msgf("%s starting listening on %s", name, srv.Addr)
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		errs <- fmt.Errorf("%s failed: %w", name, err)
+		return
+	}
+	if listening != nil {
+		listening.Store(true)
+		defer listening.Store(false)
+	}
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		errs <- fmt.Errorf("%s failed: %w", name, err)
+	}
+}
+
+// syncSavingsGoals periodically syncs monobank jars goals to firefly-iii piggy banks
+func syncSavingsGoals(ctx context.Context, mb *mono.MonoConnection, ffi *firelfyiii.FireflyiiiConnection, interval time.Duration) {
+	for {
+		goals, err := mb.SavingsGoals(ctx)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to get monobank jars")
+		} else if err := ffi.SyncSavingsGoals(ctx, goals); err != nil {
+			log.Warn().Err(err).Msg("Failed to sync jars to piggy banks")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// syncExchangeRates periodically stores monobank exchange rates of currencies in firefly-iii
+func syncExchangeRates(ctx context.Context, mb *mono.MonoConnection, ffi *firelfyiii.FireflyiiiConnection,
+	currencies []string, interval time.Duration) {
+	for {
+		rates, err := mb.ExchangeRates(ctx)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to get monobank exchange rates")
+		} else if err := ffi.SyncExchangeRates(ctx, rates, currencies); err != nil {
+			log.Warn().Err(err).Msg("Failed to sync exchange rates")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// billsCheckedKey - store key of the time bills are checked until
+const billsCheckedKey = "bills.checked_until"
+
+// reportUnpaidBills periodically logs bills expected to be paid and not paid within grace.
+// Checks continue from the time persisted in st, so bills expected while the daemon
+// was stopped are reported as well
+func reportUnpaidBills(ctx context.Context, ffi *firelfyiii.FireflyiiiConnection, st *store.Store, interval, grace time.Duration) {
+	start := time.Now().Add(-grace - interval)
+	if _, err := st.Get(billsCheckedKey, &start); err != nil {
+		log.Warn().Err(err).Msg("Failed to load time bills are checked until")
+	}
+	for {
+		end := time.Now().Add(-grace)
+		unpaid, err := ffi.UnpaidBills(ctx, start, end, grace)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to check unpaid bills")
+		} else {
+			for _, v := range unpaid {
+				log.Warn().Msgf("Bill %q expected on %s is not paid", v.Name, v.Expected.Format(time.DateOnly))
+				metrics.BillsUnpaid.WithLabelValues(v.Name).Inc()
+			}
+			start = end
+			if err := st.Set(billsCheckedKey, start); err != nil {
+				log.Warn().Err(err).Msg("Failed to persist time bills are checked until")
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/sudores/firefly-iii-bank-sync/bank/dto"
+	"github.com/sudores/firefly-iii-bank-sync/util"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ExporterNone   = ""
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+var (
+	tracer     = otel.Tracer(tracerName)
+	propagator = propagation.TraceContext{}
+)
+
+// Init sets up global tracer provider with exporter. OTLP exporter is configured
+// with standard OTEL_EXPORTER_OTLP_* env variables. Returned func flushes and stops it
+func Init(ctx context.Context, exporter string) (func(context.Context) error, error) {
+	var exp sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stderr))
+	case ExporterOTLP:
+		exp, err = otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("Tracing exporter %q is unrecognized. Eligible exporters are: stdout, otlp", exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagator)
+	return tp.Shutdown, nil
+}
+
+// StartTransaction starts the root span of transaction received from source and
+// stores its context in the transaction, so the pipeline stages continue the trace
+func StartTransaction(ctx context.Context, source string, trans *dto.TransactionDTO) (context.Context, trace.Span) {
+	ctx, span := tracer.Start(ctx, source+".receive", trace.WithAttributes(
+		attribute.String(attrSource, source),
+		attribute.String(attrAccountID, trans.AccountID),
+		attribute.String(attrTransactionID, trans.Transaction.ID),
+	))
+	trans.Trace = map[string]string{}
+	propagator.Inject(ctx, propagation.MapCarrier(trans.Trace))
+	return ctx, span
+}
+
+// Start starts span of pipeline stage continuing the trace of transaction
+func Start(ctx context.Context, trans *dto.TransactionDTO, name string) (context.Context, trace.Span) {
+	if trans.Trace != nil {
+		ctx = propagator.Extract(ctx, propagation.MapCarrier(trans.Trace))
+	}
+	return tracer.Start(ctx, name, trace.WithAttributes(
+		attribute.String(attrAccountID, trans.AccountID),
+		attribute.String(attrTransactionID, trans.Transaction.ID),
+	))
+}
+
+// StartSpan starts span of an operation not bound to a single transaction
+func StartSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name)
+}
+
+// End records err to span and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// InstrumentClient makes client to trace outgoing requests and propagate trace context
+func InstrumentClient(service string, cl *http.Client) *http.Client {
+	next := cl.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	cl.Transport = util.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		ctx, span := tracer.Start(req.Context(), service+" "+req.Method, trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(req.Method),
+				semconv.URLPath(req.URL.Path),
+				semconv.ServerAddress(req.URL.Hostname()),
+			))
+		defer span.End()
+		req = req.Clone(ctx)
+		propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+		resp, err := next.RoundTrip(req)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return resp, err
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+		if resp.StatusCode >= http.StatusBadRequest {
+			span.SetStatus(codes.Error, resp.Status)
+		}
+		return resp, nil
+	})
+	return cl
+}
@@ -0,0 +1,10 @@
+package tracing
+
+const (
+	tracerName  = "github.com/sudores/firefly-iii-bank-sync"
+	serviceName = "firefly-iii-bank-sync"
+
+	attrSource        = "fbs.source"
+	attrAccountID     = "fbs.account.id"
+	attrTransactionID = "fbs.transaction.id"
+)
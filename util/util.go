@@ -27,3 +27,10 @@ func HttpRequestToStruct(req *http.Request, obj interface{}) error {
 	}
 	return nil
 }
+
+// RoundTripperFunc is an http.RoundTripper of a function, used to wrap client transports
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}